@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// atomicFile is a temporary file in the folder of name, commit replaces name with it. Readers of name
+// see either the old or the new complete file, never a partial write.
+type atomicFile struct {
+	*os.File
+	name string
+}
+
+// createAtomic creates the temporary file for name, it must be committed or aborted. Unlike
+// os.CreateTemp it is created with 0666 minus the umask, the permissions a new file gets anyway.
+func createAtomic(name string) (*atomicFile, error) {
+	prefix := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".gdown-")
+	for try := 0; ; try++ {
+		tmp, err := os.OpenFile(prefix+strconv.FormatUint(uint64(rand.Uint32()), 10), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &atomicFile{File: tmp, name: name}, nil
+	}
+}
+
+// commit syncs the temporary file to disk and renames it to name with the permissions perm
+func (f *atomicFile) commit(perm os.FileMode) error {
+	return f.commitPerm(&perm)
+}
+
+// commitKeepPerm is commit with the permissions of the existing name, a new file keeps 0666 minus the
+// umask
+func (f *atomicFile) commitKeepPerm() error {
+	info, err := os.Stat(f.name)
+	if os.IsNotExist(err) {
+		return f.commitPerm(nil)
+	}
+	if err != nil {
+		f.abort()
+		return err
+	}
+	perm := info.Mode().Perm()
+	return f.commitPerm(&perm)
+}
+
+func (f *atomicFile) commitPerm(perm *os.FileMode) (err error) {
+	defer func() {
+		if err != nil {
+			f.abort()
+		}
+	}()
+
+	if perm != nil {
+		if err = f.Chmod(*perm); err != nil {
+			return err
+		}
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.File.Name(), f.name); err != nil {
+		return err
+	}
+
+	syncDir(filepath.Dir(f.name))
+	return nil
+}
+
+// abort removes the temporary file, name is unchanged
+func (f *atomicFile) abort() {
+	f.Close()
+	os.Remove(f.File.Name())
+}
+
+// syncDir persists the rename in dir, best effort because not every OS and file system supports it
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
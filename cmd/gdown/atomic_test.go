@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeFileAtomic writes data to name through createAtomic like fileModeHandlingInternal streams a
+// download, the permissions of an existing name are kept
+func writeFileAtomic(name string, data []byte) error {
+	f, err := createAtomic(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commitKeepPerm()
+}
+
+func Test_createAtomic(t *testing.T) {
+	folder := t.TempDir()
+	name := filepath.Join(folder, "wg0.conf")
+
+	if err := os.WriteFile(name, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(name, []byte("new")); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("content = %v, want new", string(data))
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("mode = %v, want the kept %v", info.Mode().Perm(), os.FileMode(0600))
+		}
+	}
+
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary file left, got %v", entries)
+	}
+}
+
+func Test_createAtomic_NewFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no umask on Windows")
+	}
+	folder := t.TempDir()
+	// A file created like os.WriteFile gets 0666 minus the umask
+	umasked := filepath.Join(folder, "umask")
+	if err := os.WriteFile(umasked, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.Stat(umasked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(folder, "wg0.conf")
+	if err := writeFileAtomic(name, []byte("new")); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != want.Mode().Perm() {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), want.Mode().Perm())
+	}
+}
+
+func Test_createAtomic_Error(t *testing.T) {
+	folder := t.TempDir()
+	// A folder can't be replaced by a file, the old content must stay and no temp file must be left
+	name := filepath.Join(folder, "target")
+	if err := os.Mkdir(name, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(name, "keep"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(name, []byte("new")); err == nil {
+		t.Fatal("writeFileAtomic() expected error, got nil")
+	}
+
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		t.Errorf("expected only the folder, got %v", entries)
+	}
+}
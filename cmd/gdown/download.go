@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+// download writes the content of settings.RepoFilePath to w and returns its SHA-256 as hex. The content
+// is streamed, so the file is never held in memory. A Git LFS pointer is replaced by its object, which is
+// only downloaded if its SHA-256 isn't localSha256, the hash of the existing file.
+func download(ctx context.Context, provider api.Provider, settings internal.Settings, w io.Writer, localSha256 string) (string, error) {
+	body, pointer, err := api.OpenFile(ctx, provider, settings)
+	if err != nil {
+		return "", err
+	}
+	if pointer != nil {
+		if pointer.Oid == localSha256 {
+			return pointer.Oid, nil
+		}
+		if body, err = api.OpenLFSObject(ctx, provider, settings, *pointer); err != nil {
+			return "", err
+		}
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fileHashes returns the SHA-256 and the git blob ID of the file at path as hex, to compare it with the
+// metadata of any provider. It is empty if the file doesn't exist.
+func fileHashes(path string) (api.FileMetadata, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return api.FileMetadata{}, nil
+	}
+	if err != nil {
+		return api.FileMetadata{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return api.FileMetadata{}, err
+	}
+	contentHash := sha256.New()
+	// The blob ID is the SHA-1 of the content with the header git stores objects with
+	blobHash := sha1.New()
+	fmt.Fprintf(blobHash, "blob %d\x00", info.Size())
+	if _, err := io.Copy(io.MultiWriter(contentHash, blobHash), file); err != nil {
+		return api.FileMetadata{}, err
+	}
+	return api.FileMetadata{
+		ContentSha256: hex.EncodeToString(contentHash.Sum(nil)),
+		BlobID:        hex.EncodeToString(blobHash.Sum(nil)),
+	}, nil
+}
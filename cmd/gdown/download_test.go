@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+func Test_download(t *testing.T) {
+	defer func() { api.HttpStreamFunc = rawFromJsonMock }()
+
+	content := "Test File 1\n"
+	sum := sha256.Sum256([]byte(content))
+	contentSha256 := hex.EncodeToString(sum[:])
+	jsonFile := `{"content_sha256": "` + contentSha256 + `", "content": "VGVzdCBGaWxlIDEK"}`
+
+	tests := []struct {
+		name     string
+		rawErr   error
+		json     string
+		wantErr  bool
+		wantJson bool
+	}{
+		{name: "Raw", json: `{}`},
+		{name: "Fallback to JSON", rawErr: &api.HttpError{StatusCode: http.StatusNotAcceptable}, json: jsonFile, wantJson: true},
+		{name: "Fallback with wrong checksum", rawErr: &api.HttpError{StatusCode: http.StatusBadGateway}, json: `{"content_sha256": "abc", "content": "VGVzdCBGaWxlIDEK"}`, wantErr: true, wantJson: true},
+		{name: "Not found without fallback", rawErr: &api.HttpError{StatusCode: http.StatusNotFound}, json: jsonFile, wantErr: true},
+		{name: "Network error without fallback", rawErr: errors.New("connection reset"), json: jsonFile, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonCalled := false
+			api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+				jsonCalled = true
+				return []byte(tt.json), nil, nil
+			}
+			api.HttpStreamFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) (io.ReadCloser, http.Header, error) {
+				if !strings.Contains(url, "/repository/files/dir%2Ffile1.txt/raw?ref=main") {
+					t.Errorf("raw url = %v", url)
+				}
+				if tt.rawErr != nil {
+					return nil, nil, tt.rawErr
+				}
+				return io.NopCloser(strings.NewReader(content)), nil, nil
+			}
+
+			settings := internal.Settings{ApiUrl: "https://gitlab.example.com/api/v4/", ProjectNumber: "1", Ref: "main", RepoFilePath: "dir/file1.txt"}
+			provider, err := api.NewProvider(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			got, err := download(context.Background(), provider, settings, &out, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if jsonCalled != tt.wantJson {
+				t.Errorf("download() JSON API called = %v, want %v", jsonCalled, tt.wantJson)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != contentSha256 || out.String() != content {
+				t.Errorf("download() = %v, %q, want %v, %q", got, out.String(), contentSha256, content)
+			}
+		})
+	}
+}
+
+func Test_fileHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+
+	got, err := fileHashes(path)
+	if err != nil || got != (api.FileMetadata{}) {
+		t.Errorf("fileHashes() of missing file = %+v, %v, want empty", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte("Test File 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = fileHashes(path)
+	// The blob ID is what git hash-object returns
+	want := api.FileMetadata{
+		ContentSha256: "11c014f2e9aa58bb56e6a489298ea61a3903c3e632c5aaec5d135996cab0b24e",
+		BlobID:        "1e85ff777250e0d0ba1dd079ff562e40784307e1",
+	}
+	if err != nil || got != want {
+		t.Errorf("fileHashes() = %+v, %v, want %+v", got, err, want)
+	}
+}
+
+func Test_fileModeHandlingInternal_metadata(t *testing.T) {
+	defer func() {
+		api.HttpStreamFunc = rawFromJsonMock
+		api.HttpHeadFunc = headFromJsonMock
+	}()
+
+	const localSha256 = "11c014f2e9aa58bb56e6a489298ea61a3903c3e632c5aaec5d135996cab0b24e"
+	tests := []struct {
+		name         string
+		headSha256   string
+		headErr      error
+		content      string
+		want         fileResult
+		wantDownload bool
+	}{
+		{name: "Unchanged without download", headSha256: localSha256, want: fileUnchanged},
+		{name: "Changed", headSha256: "abc", content: "Test File 2\n", want: fileUpdated, wantDownload: true},
+		{name: "No metadata", headErr: &api.HttpError{StatusCode: http.StatusMethodNotAllowed}, content: "Test File 1\n", want: fileUnchanged, wantDownload: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outFile := filepath.Join(t.TempDir(), "file1.txt")
+			if err := os.WriteFile(outFile, []byte("Test File 1\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			api.HttpHeadFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) (http.Header, error) {
+				if tt.headErr != nil {
+					return nil, tt.headErr
+				}
+				header := http.Header{}
+				header.Set("X-Gitlab-Content-Sha256", tt.headSha256)
+				return header, nil
+			}
+			downloaded := false
+			api.HttpStreamFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) (io.ReadCloser, http.Header, error) {
+				downloaded = true
+				return io.NopCloser(strings.NewReader(tt.content)), nil, nil
+			}
+
+			settings := internal.Settings{ApiUrl: "https://gitlab.example.com/api/v4/", ProjectNumber: "1", Ref: "main", RepoFilePath: "file1.txt", OutFile: outFile}
+			provider, err := api.NewProvider(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := fileModeHandlingInternal(context.Background(), provider, settings, log.New(io.Discard, "", 0))
+			if err != nil {
+				t.Fatalf("fileModeHandlingInternal() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("fileModeHandlingInternal() = %v, want %v", got, tt.want)
+			}
+			if downloaded != tt.wantDownload {
+				t.Errorf("fileModeHandlingInternal() downloaded = %v, want %v", downloaded, tt.wantDownload)
+			}
+			if data, _ := os.ReadFile(outFile); tt.content != "" && string(data) != tt.content {
+				t.Errorf("content = %q, want %q", data, tt.content)
+			}
+		})
+	}
+}
+
+func Test_fileModeHandlingInternal_keepsPerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permissions on Windows")
+	}
+	defer func() { api.HttpStreamFunc = rawFromJsonMock }()
+	api.HttpStreamFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) (io.ReadCloser, http.Header, error) {
+		return io.NopCloser(strings.NewReader("[Interface]\nPrivateKey = new\n")), nil, nil
+	}
+
+	// Single-file mode has no git mode, so the permissions of the local file are kept
+	outFile := filepath.Join(t.TempDir(), "wg0.conf")
+	if err := os.WriteFile(outFile, []byte("[Interface]\nPrivateKey = old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	settings := internal.Settings{ApiUrl: "https://gitlab.example.com/api/v4/", ProjectNumber: "1", Ref: "main", RepoFilePath: "wg0.conf", OutFile: outFile}
+	provider, err := api.NewProvider(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fileModeHandlingInternal(context.Background(), provider, settings, log.New(io.Discard, "", 0))
+	if err != nil || got != fileUpdated {
+		t.Fatalf("fileModeHandlingInternal() = %v, %v, want %v", got, err, fileUpdated)
+	}
+	info, err := os.Stat(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+}
+
+func Test_download_lfs(t *testing.T) {
+	httpDo := api.HttpDoFunc
+	defer func() { api.HttpStreamFunc = rawFromJsonMock; api.HttpDoFunc = httpDo }()
+
+	content := "firmware\n"
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 9\n"
+	api.HttpStreamFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) (io.ReadCloser, http.Header, error) {
+		return io.NopCloser(strings.NewReader(pointer)), nil, nil
+	}
+
+	settings := internal.Settings{ApiUrl: "https://gitlab.example.com/api/v4/", ProjectNumber: "infra/firmware", Ref: "main", RepoFilePath: "fw.bin", PrivateToken: "token"}
+	provider, err := api.NewProvider(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		localSha256 string
+		wantOut     string
+	}{
+		{name: "Unchanged", localSha256: oid},
+		{name: "Changed", wantOut: content},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			api.HttpDoFunc = func(c *http.Client, req *http.Request) (io.ReadCloser, http.Header, error) {
+				requests = append(requests, req.Method+" "+req.URL.String())
+				if req.Method == http.MethodPost {
+					return io.NopCloser(strings.NewReader(`{"objects": [{"oid": "` + oid + `", "actions": {"download": {"href": "https://lfs.example.com/` + oid + `"}}}]}`)), nil, nil
+				}
+				return io.NopCloser(strings.NewReader(content)), nil, nil
+			}
+
+			var out bytes.Buffer
+			got, err := download(context.Background(), provider, settings, &out, tt.localSha256)
+			if err != nil || got != oid || out.String() != tt.wantOut {
+				t.Fatalf("download() = %v, %q, %v, want %v, %q", got, out.String(), err, oid, tt.wantOut)
+			}
+			var wantRequests []string
+			if tt.wantOut != "" {
+				wantRequests = []string{"POST https://gitlab.example.com/infra/firmware.git/info/lfs/objects/batch", "GET https://lfs.example.com/" + oid}
+			}
+			if !reflect.DeepEqual(requests, wantRequests) {
+				t.Errorf("requests = %v, want %v", requests, wantRequests)
+			}
+		})
+	}
+}
+
+func Test_fileModeHandlingInternal_dryRunLFS(t *testing.T) {
+	httpDo := api.HttpDoFunc
+	defer func() {
+		api.HttpStreamFunc = rawFromJsonMock
+		api.HttpHeadFunc = headFromJsonMock
+		api.HttpDoFunc = httpDo
+	}()
+
+	content := "firmware\n"
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 9\n"
+	pointerSum := sha256.Sum256([]byte(pointer))
+
+	// The metadata is the one of the pointer, so it never matches the local object
+	api.HttpHeadFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) (http.Header, error) {
+		header := http.Header{}
+		header.Set("X-Gitlab-Content-Sha256", hex.EncodeToString(pointerSum[:]))
+		return header, nil
+	}
+	api.HttpStreamFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) (io.ReadCloser, http.Header, error) {
+		return io.NopCloser(strings.NewReader(pointer)), nil, nil
+	}
+	api.HttpDoFunc = func(c *http.Client, req *http.Request) (io.ReadCloser, http.Header, error) {
+		t.Errorf("unexpected request %v %v", req.Method, req.URL)
+		return nil, nil, errors.New("unexpected request")
+	}
+
+	outFile := filepath.Join(t.TempDir(), "fw.bin")
+	if err := os.WriteFile(outFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := internal.Settings{ApiUrl: "https://gitlab.example.com/api/v4/", ProjectNumber: "infra/firmware", Ref: "main", RepoFilePath: "fw.bin", OutFile: outFile, DryRun: true}
+	provider, err := api.NewProvider(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fileModeHandlingInternal(context.Background(), provider, settings, log.New(io.Discard, "", 0))
+	if err != nil || got != fileUnchanged {
+		t.Errorf("fileModeHandlingInternal() = %v, %v, want %v", got, err, fileUnchanged)
+	}
+}
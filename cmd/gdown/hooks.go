@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// Environment variables for the hooks
+const (
+	EnvChangedFile  = "GDOWN_CHANGED_FILE"
+	EnvRepoFile     = "GDOWN_REPO_FILE"
+	EnvChangedFiles = "GDOWN_CHANGED_FILES"
+	EnvDeletedFiles = "GDOWN_DELETED_FILES"
+)
+
+// backupSuffix is the suffix of the backups for -rollback
+const backupSuffix = ".gdown-backup"
+
+// change is a local file written, deleted or skipped by a run
+type change struct {
+	action   action
+	outFile  string
+	repoFile string
+	// reason why the file is skipped or changed
+	reason string
+	// backup is the old file to roll back to, nil without -rollback
+	backup *backup
+}
+
+// runFileHook runs the per file hook for a changed file and rolls it back if the hook fails
+func runFileHook(ctx context.Context, settings internal.Settings, c change, logger *log.Logger) error {
+	env := []string{
+		EnvChangedFile + "=" + c.outFile,
+		EnvRepoFile + "=" + c.repoFile,
+	}
+	err := runHook(ctx, settings.OnFileChange, settings.HookTimeout, env, logger)
+	if err == nil {
+		return nil
+	}
+	if c.backup != nil {
+		if rollbackErr := c.backup.restore(c.outFile); rollbackErr != nil {
+			return fmt.Errorf("hook %w, rollback failed: %v", err, rollbackErr)
+		}
+		logger.Println("Rolled back:", c.repoFile, ", because the hook failed")
+	}
+	return fmt.Errorf("hook %w", err)
+}
+
+// changeHook is a per run hook with the changes of all mappings which have it
+type changeHook struct {
+	settings internal.Settings
+	changes  []change
+}
+
+// addChangeHook adds the changes of the mapping with settings to the hook with the same command, so
+// every command runs only once per run
+func addChangeHook(hooks []changeHook, settings internal.Settings, changes []change) []changeHook {
+	if settings.OnChange == "" || len(changes) == 0 {
+		return hooks
+	}
+	for i := range hooks {
+		if hooks[i].settings.OnChange == settings.OnChange {
+			hooks[i].changes = append(hooks[i].changes, changes...)
+			return hooks
+		}
+	}
+	return append(hooks, changeHook{settings: settings, changes: changes})
+}
+
+// runChangeHooks runs every per run hook once after all mappings are synced
+func runChangeHooks(ctx context.Context, hooks []changeHook) error {
+	var errs []error
+	for _, hook := range hooks {
+		if err := runChangeHook(ctx, hook.settings, hook.changes); err != nil {
+			log.Println("Error:", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runChangeHook runs the per run hook once for all changes and rolls them back if the hook fails.
+// Deleted files are not rolled back.
+func runChangeHook(ctx context.Context, settings internal.Settings, changes []change) error {
+	var changed, deleted []string
+	for _, c := range changes {
+		if c.action == actionDelete {
+			deleted = append(deleted, c.outFile)
+			continue
+		}
+		changed = append(changed, c.outFile)
+	}
+
+	env := []string{
+		EnvChangedFiles + "=" + strings.Join(changed, "\n"),
+		EnvDeletedFiles + "=" + strings.Join(deleted, "\n"),
+	}
+	err := runHook(ctx, settings.OnChange, settings.HookTimeout, env, log.Default())
+	if err == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, c := range changes {
+		if c.backup == nil {
+			continue
+		}
+		if rollbackErr := c.backup.restore(c.outFile); rollbackErr != nil {
+			errs = append(errs, fmt.Errorf("rollback %v: %w", c.outFile, rollbackErr))
+			continue
+		}
+		log.Println("Rolled back:", c.repoFile, ", because the hook failed")
+	}
+	return errors.Join(append([]error{fmt.Errorf("hook %w", err)}, errs...)...)
+}
+
+// runHook runs command with the shell of the OS and logs its output. It fails if the command exits
+// with non-zero or runs longer than timeout.
+func runHook(ctx context.Context, command string, timeout time.Duration, env []string, logger *log.Logger) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	// Don't wait forever for children which inherited the output
+	cmd.WaitDelay = time.Second
+
+	logger.Println("Run hook:", command)
+	output, err := cmd.CombinedOutput()
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		logger.Println("Hook:", scanner.Text())
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%v timed out after %v", command, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%v failed: %v", command, err)
+	}
+	return nil
+}
+
+// backup keeps the old version of a file until the hooks succeeded
+type backup struct {
+	existed bool
+	perm    os.FileMode
+	// path is a hard link or copy of the old file
+	path string
+	// linkTarget is the old target if the file was a symbolic link
+	linkTarget string
+	isLink     bool
+}
+
+// newBackup saves the current state of name, which doesn't need to exist
+func newBackup(name string) (*backup, error) {
+	info, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return &backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b := &backup{existed: true, perm: info.Mode().Perm()}
+	if info.Mode()&os.ModeSymlink != 0 {
+		b.isLink = true
+		b.linkTarget, err = os.Readlink(name)
+		return b, err
+	}
+
+	b.path = filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+backupSuffix)
+	os.Remove(b.path)
+	// A hard link keeps the old content when the file is replaced by rename, copy if not supported
+	if err := os.Link(name, b.path); err != nil {
+		if err := copyFile(name, b.path); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// restore replaces name with the backup
+func (b *backup) restore(name string) error {
+	if !b.existed {
+		return os.Remove(name)
+	}
+	if b.isLink {
+		tmp := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".gdown-link")
+		os.Remove(tmp)
+		if err := os.Symlink(b.linkTarget, tmp); err != nil {
+			return err
+		}
+		return os.Rename(tmp, name)
+	}
+	if err := os.Rename(b.path, name); err != nil {
+		return err
+	}
+	b.path = ""
+	// A hard link shares the mode with the new file, which may have been changed
+	return os.Chmod(name, b.perm)
+}
+
+// discard removes the backup, the new file stays
+func (b *backup) discard() {
+	if b.path != "" {
+		os.Remove(b.path)
+		b.path = ""
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_runHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use sh syntax")
+	}
+
+	tests := []struct {
+		name       string
+		command    string
+		timeout    time.Duration
+		wantErr    bool
+		wantOutput string
+	}{
+		{name: "Success", command: `echo "changed $GDOWN_CHANGED_FILE"`, timeout: time.Minute, wantOutput: "Hook: changed /etc/wg0.conf"},
+		{name: "Failure", command: `echo broken >&2; exit 3`, timeout: time.Minute, wantErr: true, wantOutput: "Hook: broken"},
+		{name: "Timeout", command: `sleep 10`, timeout: 50 * time.Millisecond, wantErr: true, wantOutput: "Run hook: sleep 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			output := captureOutput(func() {
+				err = runHook(context.Background(), tt.command, tt.timeout, []string{EnvChangedFile + "=/etc/wg0.conf"}, log.Default())
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runHook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !strings.Contains(output, tt.wantOutput) {
+				t.Errorf("runHook() output = %v, want %v", output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func Test_backup(t *testing.T) {
+	folder := t.TempDir()
+
+	t.Run("Existing file", func(t *testing.T) {
+		name := filepath.Join(folder, "existing.conf")
+		if err := os.WriteFile(name, []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := newBackup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFileAtomic(name, []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.restore(name); err != nil {
+			t.Fatalf("restore() error = %v", err)
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "old" {
+			t.Errorf("content = %v, want old", string(data))
+		}
+		if exists(name + backupSuffix) {
+			t.Error("expected backup to be gone after restore")
+		}
+	})
+
+	t.Run("New file", func(t *testing.T) {
+		name := filepath.Join(folder, "new.conf")
+
+		b, err := newBackup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFileAtomic(name, []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.restore(name); err != nil {
+			t.Fatalf("restore() error = %v", err)
+		}
+		if exists(name) {
+			t.Error("expected new file to be removed")
+		}
+	})
+
+	t.Run("Discard", func(t *testing.T) {
+		name := filepath.Join(folder, "discard.conf")
+		if err := os.WriteFile(name, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := newBackup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.discard()
+
+		entries, err := os.ReadDir(folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), backupSuffix) {
+				t.Errorf("expected no backup left, got %v", entry.Name())
+			}
+		}
+	})
+}
+
+func Test_main_mode_file_hook_rollback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use sh syntax")
+	}
+
+	filePath, err := getTempFilePath()
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(filePath)
+	if err := os.WriteFile(filePath, []byte("old content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	setFlagsFile(filePath)
+	mockFileApi()
+
+	onFileChange := `test "$(cat "$GDOWN_CHANGED_FILE")" != "old content" && exit 1`
+	rollback := true
+	flagOnFileChangePtr = &onFileChange
+	flagRollbackPtr = &rollback
+	defer func() {
+		noHook := ""
+		noRollback := false
+		flagOnFileChangePtr = &noHook
+		flagRollbackPtr = &noRollback
+	}()
+
+	var exitCode int
+	output := captureOutput(func() {
+		exitCode = mainSub()
+	})
+
+	if exitCode != ExitError {
+		t.Errorf("mainSub() = %v, want %v", exitCode, ExitError)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "old content" {
+		t.Errorf("content = %v, want rollback to old content", string(data))
+	}
+	if !strings.Contains(output, "Rolled back: settings.json") {
+		t.Errorf("mainSub() got console output = \"%v\", want rollback", output)
+	}
+	log.SetOutput(nil)
+}
+
+func Test_main_mode_file_hook_on_change(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use sh syntax")
+	}
+
+	filePath, err := getTempFilePath()
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(filePath)
+
+	setFlagsFile(filePath)
+	mockFileApi()
+
+	onChange := `echo "reload $GDOWN_CHANGED_FILES"`
+	flagOnChangePtr = &onChange
+	defer func() {
+		noHook := ""
+		flagOnChangePtr = &noHook
+	}()
+
+	var exitCode int
+	output := captureOutput(func() {
+		exitCode = mainSub()
+	})
+	if exitCode != ExitChanged {
+		t.Errorf("mainSub() = %v, want %v", exitCode, ExitChanged)
+	}
+	if !strings.Contains(output, "Hook: reload "+filePath) {
+		t.Errorf("mainSub() got console output = \"%v\", want hook output", output)
+	}
+
+	// Unchanged, so no hook
+	output = captureOutput(func() {
+		exitCode = mainSub()
+	})
+	if exitCode != ExitUnchanged {
+		t.Errorf("mainSub() = %v, want %v", exitCode, ExitUnchanged)
+	}
+	if strings.Contains(output, "Run hook") {
+		t.Errorf("mainSub() got console output = \"%v\", want no hook", output)
+	}
+	log.SetOutput(nil)
+}
+
+func Test_main_config_hook_on_change(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use sh syntax")
+	}
+
+	folder := t.TempDir()
+	configPath := filepath.Join(folder, "gdown.json")
+	a, b := filepath.Join(folder, "a.json"), filepath.Join(folder, "b.json")
+	config := fmt.Sprintf(`{"sources": [{
+		"url": "https://gitlab.com/api/v4/",
+		"token": "5BUJpxdVx9fyq5KrXJx6",
+		"project": 16447351,
+		"ref": "master",
+		"mappings": [
+			{"repoFile": "settings.json", "outPath": %q},
+			{"repoFile": "settings.json", "outPath": %q}
+		]
+	}]}`, a, b)
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	setFlagsNone()
+	flagConfigPtr = &configPath
+	onChange := `echo reload $GDOWN_CHANGED_FILES`
+	flagOnChangePtr = &onChange
+	defer func() {
+		empty := ""
+		flagConfigPtr, flagOnChangePtr = &empty, &empty
+	}()
+	mockFileApi()
+
+	var exitCode int
+	output := captureOutput(func() {
+		exitCode = mainSub()
+	})
+	if exitCode != ExitChanged {
+		t.Errorf("mainSub() = %v, want %v\n%v", exitCode, ExitChanged, output)
+	}
+	if count := strings.Count(output, "Run hook:"); count != 1 {
+		t.Errorf("mainSub() ran the hook %v times, want once\n%v", count, output)
+	}
+	if !strings.Contains(output, "Hook: reload "+a+" "+b) {
+		t.Errorf("mainSub() got console output = \"%v\", want the changes of both mappings", output)
+	}
+	log.SetOutput(nil)
+}
@@ -1,18 +1,23 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/hex"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/haevg-rz/git-file-downloader/internal"
 	"github.com/haevg-rz/git-file-downloader/internal/api"
@@ -21,73 +26,227 @@ import (
 // AppName is the name of the application
 const AppName = "GitLab File Downloader"
 
+// Exit codes, documented in README.md
+const (
+	ExitUnchanged   = 0
+	ExitError       = 1
+	ExitChanged     = 2
+	ExitInvalidArgs = 3
+)
+
 var (
 	version  = "undef"
 	commitID = "undef"
 
-	flagTokenPtr = flag.String(internal.FlagNameToken, ``, `Private-Token with access right for "api" and "read_repository, role must be minimum "Reporter""`)
+	flagTokenPtr = flag.String(internal.FlagNameToken, ``, `Private-Token with access right for "api" and "read_repository", role must be minimum "Reporter", prefer GDOWN_TOKEN, GITLAB_TOKEN, GITHUB_TOKEN, GITEA_TOKEN, BITBUCKET_TOKEN or AZURE_DEVOPS_EXT_PAT`)
+
+	flagTokenFilePtr        = flag.String(internal.FlagNameTokenFile, ``, "File with the Private-Token, must not be accessible by group or others")
+	flagCredentialHelperPtr = flag.Bool(internal.FlagNameCredentialHelper, false, "Get the Private-Token from the git credential helper for the host of -url")
+	flagAuthTypePtr         = flag.String(internal.FlagNameAuthType, ``, "How the token is sent: private (Private-Token), job (JOB-TOKEN), deploy (deploy token with -username) or bearer (OAuth2), in a GitLab CI job without token CI_JOB_TOKEN is used (default private)")
+	flagUsernamePtr         = flag.String(internal.FlagNameUsername, ``, "Username of the deploy token")
 
 	flagOutPathPtr      = flag.String(internal.FlagNameOutPath, ``, "Path to write file to disk")
 	flagRepoFilePathPar = flag.String(internal.FlagNameRepoFilePath, ``, "File path in repo, like src/main.go")
 
-	flagBranchPtr = flag.String(internal.FlagNameBranch, `main`, "Branch")
+	flagBranchPtr = flag.String(internal.FlagNameBranch, `main`, "Branch, use -ref for tags and commits")
+	flagRefPtr    = flag.String(internal.FlagNameRef, ``, "Branch, tag or commit SHA, overrides -branch")
 
 	flagOutFolderPtr      = flag.String(internal.FlagNameOutFolder, ``, "Folder to write file to disk")
 	flagRepoFolderPathPtr = flag.String(internal.FlagNameRepoFolderPathEscaped, ``, "Folder to write file to disk")
 
-	flagUrlPtr           = flag.String(internal.FlagNameUrl, ``, "Url to Api v4, like https://my-git-lab-server.local/api/v4/")
+	flagProviderPtr      = flag.String(internal.FlagNameProvider, internal.ProviderGitLab, "Git hosting service of the project: gitlab, github, gitea (also for Forgejo), bitbucket (Server and Data Center), azure (Azure DevOps) or git (a repository read with the git command, default for a file:// url)")
+	flagUrlPtr           = flag.String(internal.FlagNameUrl, ``, "Url to Api v4, like https://my-git-lab-server.local/api/v4/, for github https://my-github-server.local/api/v3/ (default https://api.github.com/), for gitea https://my-gitea-server.local/api/v1/, for bitbucket https://my-bitbucket-server.local/rest/api/latest/, for azure https://dev.azure.com/org/, for git the path, file:// or http(s) url of the repository")
+	flagGitCachePtr      = flag.String(internal.FlagNameGitCache, ``, "Folder for the shallow fetches of a git http(s) remote (default the user cache folder)")
 	flagProjectNumberPtr = flag.Int(internal.FlagNameProjectNumber, 0, "The Project ID from your project")
+	flagProjectPtr       = flag.String(internal.FlagNameProject, ``, "The project ID, path like group/subgroup/project or web URL like https://my-git-lab-server.local/group/project, which also sets -url, for github and gitea owner/repo, for bitbucket KEY/repo, for azure project/repo")
 
 	flagIncludeOnlyPtr = flag.String(internal.IncludeOnly, ``, "Include only these regex pattern")
 	flagExcludePtr     = flag.String(internal.Exclude, ``, "Exclude these regex pattern")
+
+	flagInsecurePtr       = flag.Bool(internal.FlagNameInsecure, false, "Skip the verification of the server certificate, NOT recommended")
+	flagCACertFilePtr     = flag.String(internal.FlagNameCACertFile, ``, "PEM file with additional CA certificates to trust")
+	flagClientCertFilePtr = flag.String(internal.FlagNameClientCertFile, ``, "PEM file with the client certificate for mutual TLS")
+	flagClientKeyFilePtr  = flag.String(internal.FlagNameClientKeyFile, ``, "PEM file with the private key of the client certificate")
+	flagTLSMinVersionPtr  = flag.String(internal.FlagNameTLSMinVersion, `1.2`, "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3")
+
+	flagConnectTimeoutPtr = flag.Duration(internal.FlagNameConnectTimeout, 10*time.Second, "Timeout to connect to the server incl. TLS handshake, 0 for no timeout")
+	flagTimeoutPtr        = flag.Duration(internal.FlagNameTimeout, 5*time.Minute, "Timeout for the response of a request and for every read of its body, 0 for no timeout")
+
+	flagRetriesPtr      = flag.Int(internal.FlagNameRetries, 3, "Retries after network errors, HTTP 429 and 5xx, 0 to disable")
+	flagRetryWaitPtr    = flag.Duration(internal.FlagNameRetryWait, time.Second, "Wait before the first retry, doubles with every retry (with jitter)")
+	flagRetryMaxWaitPtr = flag.Duration(internal.FlagNameRetryMaxWait, 30*time.Second, "Maximum wait between retries, also for Retry-After and RateLimit-Reset of the server")
+
+	flagParallelPtr = flag.Int(internal.FlagNameParallel, 4, "Number of parallel downloads in folder mode")
+	flagDeletePtr   = flag.Bool(internal.FlagNameDelete, false, "Mirror folder mode: delete local files and empty folders which are not in the remote folder")
+
+	flagFileModePtr = flag.String(internal.FlagNameFileMode, ``, "Permissions of written files like 0640, executable files get the execute bits added (default 0644 if the git mode is known, otherwise the permissions of existing files are kept)")
+	flagDirModePtr  = flag.String(internal.FlagNameDirMode, ``, "Permissions of created folders like 0750 (default 0755)")
+
+	flagSubmodulesPtr = flag.String(internal.FlagNameSubmodules, internal.SubmodulesSkip, "Submodules in folder mode: skip or recurse to sync them from their project on the same host and provider, not with -provider git")
+
+	flagOnChangePtr     = flag.String(internal.FlagNameOnChange, ``, "Command to run once after all mappings if any file changed, paths in env GDOWN_CHANGED_FILES and GDOWN_DELETED_FILES")
+	flagOnFileChangePtr = flag.String(internal.FlagNameOnFileChange, ``, "Command to run after each changed file, path in env GDOWN_CHANGED_FILE and GDOWN_REPO_FILE")
+	flagHookTimeoutPtr  = flag.Duration(internal.FlagNameHookTimeout, time.Minute, "Timeout for a hook command, 0 for no timeout")
+	flagRollbackPtr     = flag.Bool(internal.FlagNameRollback, false, "Restore the previous files if a hook exits with non-zero")
+
+	flagDryRunPtr     = flag.Bool(internal.FlagNameDryRun, false, "Compare the files and print the plan of create, update, delete and skip actions without changing anything on disk")
+	flagPlanFormatPtr = flag.String(internal.FlagNamePlanFormat, internal.PlanFormatText, "Format of the dry run plan: text in the log or json on stdout")
+
+	flagConfigPtr = flag.String(internal.FlagNameConfig, ``, "JSON file (no YAML or TOML) with several sources and mappings to sync in one run, relative paths in it are relative to the file, the other flags are the defaults")
 )
 
 func main() {
-	mainSub()
+	os.Exit(mainSub())
 }
 
-func mainSub() {
+func mainSub() int {
 	log.Println(AppName, "Version:", version, "Commit:", commitID)
 	log.Println(`Project: https://github.com/haevg-rz/git-file-downloader/`)
 
-	flag.Parse()
+	// flag.ExitOnError would exit with 2, which is ExitChanged
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitUnchanged
+		}
+		return ExitInvalidArgs
+	}
 
 	settings := getSettingsFromFlags()
-	isValid, args, msgs := settings.IsValid()
+	all, isValid, args, msgs := getAllSettings(settings)
 	if !isValid {
 		log.Println("Arguments are missing:", args)
 		log.Println("Messages:", msgs)
 		flag.PrintDefaults()
-		return
+		return ExitInvalidArgs
 	}
 
-	branches, err := api.GetBranches(settings)
-	if err != nil || len(branches) == 0 {
-		log.Println("Error GetBranches:", err)
-		return
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var changes []change
+	var hooks []changeHook
+	var errs []error
+	for _, s := range all {
+		if len(all) > 1 {
+			log.Println("Sync", syncTarget(s))
+		}
+		syncChanges, err := syncSettings(ctx, s)
+		changes = append(changes, syncChanges...)
+		hooks = addChangeHook(hooks, s, changedOnly(syncChanges))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
 	}
 
-	found := false
-	for _, branch := range branches {
-		if branch.Name == settings.Branch {
-			found = true
+	// Also after errors, the next run wouldn't see the successful changes as changed anymore
+	if !settings.DryRun && ctx.Err() == nil {
+		errs = append(errs, runChangeHooks(ctx, hooks))
+	}
+	for _, c := range changes {
+		if c.backup != nil {
+			c.backup.discard()
 		}
 	}
+	err := errors.Join(errs...)
 
-	if !found {
-		log.Println("Branch not found:", settings.Branch)
-		log.Println("Available branches:", branches)
-		return
+	if settings.DryRun {
+		if planErr := printPlan(settings, changes, err); planErr != nil {
+			log.Println("Error:", planErr)
+			err = errors.Join(err, planErr)
+		}
+	}
+
+	if ctx.Err() != nil {
+		log.Println("Aborted:", context.Cause(ctx))
+		return ExitError
+	}
+	return exitCode(len(changedOnly(changes)) > 0, err)
+}
+
+// getAllSettings returns the settings from the flags, or with -config one settings per mapping of the
+// config file with the flags as defaults
+func getAllSettings(settings internal.Settings) ([]internal.Settings, bool, []string, []string) {
+	if *flagConfigPtr == "" {
+		isValid, args, msgs := settings.IsValid()
+		return []internal.Settings{settings}, isValid, args, msgs
+	}
+
+	if settings.OutFile != "" || settings.OutFolder != "" || settings.RepoFilePath != "" || settings.RepoFolderPath != "" {
+		return nil, false, nil, []string{fmt.Sprint("You can't use ", internal.FlagNameConfig, " with ", internal.FlagNameOutPath, ", ", internal.FlagNameOutFolder, ", ",
+			internal.FlagNameRepoFilePath, " or ", internal.FlagNameRepoFolderPathEscaped, ", use mappings in the config file")}
+	}
+	config, err := internal.LoadConfig(*flagConfigPtr)
+	if err != nil {
+		return nil, false, nil, []string{err.Error()}
+	}
+	isValid, args, msgs := config.IsValid(settings)
+	return config.Settings(settings), isValid, args, msgs
+}
+
+// syncTarget describes the mapping of settings for the log
+func syncTarget(settings internal.Settings) string {
+	if settings.Mode() == internal.ModeFile {
+		return fmt.Sprintf("%v of project %v to %v", settings.RepoFilePath, settings.ProjectNumber, settings.OutFile)
+	}
+	return fmt.Sprintf("%v of project %v to %v", settings.RepoFolderPath, settings.ProjectNumber, settings.OutFolder)
+}
+
+// syncSettings syncs the file or folder of settings. It returns the changed and skipped local files,
+// their backups are kept for the per run hook.
+func syncSettings(ctx context.Context, settings internal.Settings) ([]change, error) {
+	if settings.Insecure {
+		log.Println("Warning: verification of the server certificate is disabled by", internal.FlagNameInsecure)
 	}
 
+	token, err := settings.ResolveToken(ctx)
+	if err != nil {
+		log.Println("Error:", err)
+		return nil, err
+	}
+	settings.PrivateToken = token
+
+	provider, err := api.NewProvider(settings)
+	if err != nil {
+		log.Println("Error:", err)
+		return nil, err
+	}
+
+	refKind, err := provider.ResolveRef(ctx, settings)
+	if err != nil {
+		log.Println("Error ResolveRef:", err)
+		if errors.Is(err, api.ErrRefNotFound) {
+			logAvailableBranches(ctx, provider, settings)
+		}
+		return nil, err
+	}
+	log.Println("Ref:", settings.Ref, "is a", refKind)
+
+	var changes []change
 	switch settings.Mode() {
 	case internal.ModeFile:
 		log.Println("Mode: File")
-		fileModeHandling(settings)
+		changes, err = fileModeHandling(ctx, provider, settings, log.Default())
 	case internal.ModeFolder:
 		log.Println("Mode: Folder")
-		folderModeHandling(settings)
+		changes, err = folderModeHandling(ctx, provider, settings)
+	}
+	return changes, err
+}
+
+// exitCode returns ExitError if anything failed, even if other files changed, otherwise ExitChanged
+// or ExitUnchanged
+func exitCode(changed bool, err error) int {
+	if err != nil {
+		return ExitError
+	}
+	if changed {
+		return ExitChanged
 	}
+	return ExitUnchanged
 }
 
 // exists returns whether the given file or directory exists
@@ -102,125 +261,351 @@ func exists(path string) bool {
 	return false
 }
 
-func folderModeHandling(settings internal.Settings) {
-	if !exists(settings.OutFolder) {
-		err := os.Mkdir(settings.OutFolder, 0755)
+// folderModeHandling syncs the remote folder into settings.OutFolder. It returns the changed and
+// skipped local files and all errors joined.
+func folderModeHandling(ctx context.Context, provider api.Provider, settings internal.Settings) ([]change, error) {
+	dirPerm, err := settings.DirPerm()
+	if err != nil {
+		log.Println("Error:", err)
+		return nil, err
+	}
+
+	if !settings.DryRun && !exists(settings.OutFolder) {
+		err := os.Mkdir(settings.OutFolder, dirPerm)
 		if err != nil {
 			log.Println("Error:", err)
-			return
+			return nil, err
 		}
 	}
 
-	files, err := api.GetFilesFromFolder(settings)
+	files, err := provider.GetFilesFromFolderRecursive(ctx, settings)
 	if err != nil {
 		log.Println("Error:", err)
-		return
+		return nil, err
 	}
 
 	log.Println("Sync", len(files), "files, from remote folder", settings.RepoFolderPath)
 
+	// Sorted by path every folder comes before its content
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	var jobs []*job
+	var submodules []api.RepoFile
+	skippedFolders := map[string]bool{}
 	for _, file := range files {
+		relPath := relativeRepoPath(settings.RepoFolderPath, file.Path)
 
-		if settings.IncludeOnly != "" {
-			m, err := regexp.MatchString(settings.IncludeOnly, file.Name)
-			if err == nil {
-				if !m {
-					log.Println("Skip:", file.Name, "because include only rule:", settings.IncludeOnly)
-					continue
-				}
+		if skippedFolders[path.Dir(relPath)] {
+			if file.Type == "tree" {
+				skippedFolders[relPath] = true
 			}
+			continue
 		}
-		if settings.Exclude != "" {
-			m, err := regexp.MatchString(settings.Exclude, file.Name)
-			if err == nil {
-				if m {
-					log.Println("Skip:", file.Name, "because exclude rule:", settings.Exclude)
-					continue
-				}
+
+		outPath := filepath.Join(settings.OutFolder, filepath.FromSlash(relPath))
+
+		if reason := filterReason(settings, file.Name); reason != "" {
+			name := file.Name
+			skipped := change{action: actionSkip, outFile: outPath, repoFile: file.Path, reason: reason}
+			jobs = append(jobs, newJob(func(logger *log.Logger) ([]change, error) {
+				logger.Println("Skip:", name, "because", reason)
+				return []change{skipped}, nil
+			}))
+			if file.Type == "tree" {
+				skippedFolders[relPath] = true
 			}
+			continue
 		}
 
 		if file.Type == "tree" {
-			folderSettings := settings
-			outFolder := path.Join(folderSettings.OutFolder, file.Name)
-			folderSettings.OutFolder = outFolder
-			folderSettings.RepoFolderPath = file.Path
-			folderModeHandling(folderSettings)
+			// Folders are created before any download starts, the files are downloaded in parallel
+			if !settings.DryRun && !exists(outPath) {
+				err := os.Mkdir(outPath, dirPerm)
+				if err != nil {
+					jobs = append(jobs, newJob(func(logger *log.Logger) ([]change, error) {
+						logger.Println("Error:", err)
+						return nil, err
+					}))
+					skippedFolders[relPath] = true
+				}
+			}
+			continue
+		}
 
+		if file.Type == "commit" {
+			if settings.Submodules == internal.SubmodulesRecurse {
+				submodules = append(submodules, file)
+				continue
+			}
+			name := file.Name
+			skipped := change{action: actionSkip, outFile: outPath, repoFile: file.Path, reason: "it is a submodule"}
+			jobs = append(jobs, newJob(func(logger *log.Logger) ([]change, error) {
+				logger.Println("Skip:", name, "because it is a submodule, use", "-"+internal.FlagNameSubmodules, internal.SubmodulesRecurse, "to sync it")
+				return []change{skipped}, nil
+			}))
 			continue
 		}
 
 		fileSettings := settings
-		outFile := path.Join(fileSettings.OutFolder, path.Base(file.Path))
-		fileSettings.OutFile = outFile
+		fileSettings.OutFile = outPath
 		fileSettings.RepoFilePath = file.Path
+		fileSettings.RepoFileMode = file.Mode
+		fileSettings.RepoFileID = file.ID
+
+		jobs = append(jobs, newJob(func(logger *log.Logger) ([]change, error) {
+			return fileModeHandling(ctx, provider, fileSettings, logger)
+		}))
+	}
+
+	changes, errs := runJobs(ctx, settings.Parallel, jobs)
+
+	for _, file := range submodules {
+		if ctx.Err() != nil {
+			break
+		}
+		outPath := filepath.Join(settings.OutFolder, filepath.FromSlash(relativeRepoPath(settings.RepoFolderPath, file.Path)))
+		subSettings, err := submoduleSettings(ctx, provider, settings, file, outPath)
+		if err != nil {
+			log.Println("Error at submodule", file.Path, ":", err)
+			errs = append(errs, fmt.Errorf("%v: %w", file.Path, err))
+			continue
+		}
+		log.Println("Sync submodule", file.Path, "at commit", file.ID)
+		subChanges, err := folderModeHandling(ctx, provider, subSettings)
+		changes = append(changes, subChanges...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", file.Path, err))
+		}
+	}
+
+	if settings.Delete && ctx.Err() == nil {
+		deleted, deleteErrs := deleteNotInRemote(settings, files)
+		changes = append(changes, deleted...)
+		errs = append(errs, deleteErrs...)
+	}
+
+	if len(errs) > 0 {
+		log.Println("Sync finished with", len(errs), "errors:")
+		for _, err := range errs {
+			log.Println(" -", err)
+		}
+	}
+	return changes, errors.Join(errs...)
+}
 
-		fileModeHandling(fileSettings)
+// relativeRepoPath returns repoPath relative to the synced repo folder
+func relativeRepoPath(repoFolderPath, repoPath string) string {
+	root := strings.Trim(repoFolderPath, "/")
+	if root == "" || root == "." {
+		return repoPath
+	}
+	return strings.TrimPrefix(repoPath, root+"/")
+}
+
+// filterReason returns why name is skipped by the include only or exclude rule, or an empty string if not
+func filterReason(settings internal.Settings, name string) string {
+	if settings.IncludeOnly != "" {
+		m, err := regexp.MatchString(settings.IncludeOnly, name)
+		if err == nil {
+			if !m {
+				return "include only rule: " + settings.IncludeOnly
+			}
+		}
 	}
+	if settings.Exclude != "" {
+		m, err := regexp.MatchString(settings.Exclude, name)
+		if err == nil {
+			if m {
+				return "exclude rule: " + settings.Exclude
+			}
+		}
+	}
+	return ""
 }
 
-func fileModeHandling(settings internal.Settings) {
-	new, err := fileModeHandlingInternal(settings)
+// fileModeHandling syncs a single file, logs the result and runs the per file hook. It returns the
+// change of the local file, which is a skip if the file is equal.
+func fileModeHandling(ctx context.Context, provider api.Provider, settings internal.Settings, logger *log.Logger) ([]change, error) {
+	var b *backup
+	if settings.Rollback && !settings.DryRun {
+		var err error
+		b, err = newBackup(settings.OutFile)
+		if err != nil {
+			logger.Println("Error at", settings.RepoFilePath, ":", err)
+			return nil, fmt.Errorf("%v: backup: %w", settings.RepoFilePath, err)
+		}
+	}
+
+	handle := fileModeHandlingInternal
+	if settings.RepoFileMode == internal.GitModeSymlink {
+		handle = symlinkHandlingInternal
+	}
+	result, err := handle(ctx, provider, settings, logger)
 
+	if b != nil && (err != nil || result == fileUnchanged) {
+		b.discard()
+	}
 	if err != nil {
-		log.Println("Error at", settings.RepoFilePath, ":", err)
-		return
+		logger.Println("Error at", settings.RepoFilePath, ":", err)
+		return nil, fmt.Errorf("%v: %w", settings.RepoFilePath, err)
 	}
-	if new {
-		log.Println("Wrote file:", settings.RepoFilePath, ", because is new or changed")
-		return
+
+	wrote, changedMode := "Wrote", "Changed mode:"
+	if settings.DryRun {
+		wrote, changedMode = "Would write", "Would change mode:"
+	}
+	c := change{outFile: settings.OutFile, repoFile: settings.RepoFilePath, backup: b}
+	switch result {
+	case fileCreated, fileUpdated:
+		c.action, c.reason = actionUpdate, "content is different"
+		if result == fileCreated {
+			c.action, c.reason = actionCreate, "it is new"
+		}
+		if settings.RepoFileMode == internal.GitModeSymlink {
+			logger.Println(wrote, "symlink:", settings.RepoFilePath, ", because is new or changed")
+			break
+		}
+		logger.Println(wrote, "file:", settings.RepoFilePath, ", because is new or changed")
+	case fileModeChanged:
+		c.action, c.reason = actionUpdate, "mode is different"
+		logger.Println(changedMode, settings.RepoFilePath, ", because content is equal but mode is different")
+	default:
+		logger.Println("Skip:", settings.RepoFilePath, ", because content is equal")
+		c.action, c.reason = actionSkip, "content is equal"
+		return []change{c}, nil
+	}
+
+	if settings.OnFileChange != "" && !settings.DryRun {
+		if err := runFileHook(ctx, settings, c, logger); err != nil {
+			logger.Println("Error at", settings.RepoFilePath, ":", err)
+			if b != nil {
+				// Rolled back, so nothing changed
+				return nil, fmt.Errorf("%v: %w", settings.RepoFilePath, err)
+			}
+			return []change{c}, fmt.Errorf("%v: %w", settings.RepoFilePath, err)
+		}
 	}
-	log.Println("Skip:", settings.RepoFilePath, ", because content is equal")
+	return []change{c}, nil
 }
 
-func fileModeHandlingInternal(settings internal.Settings) (bool, error) {
+// fileResult is what fileModeHandlingInternal did, or with settings.DryRun would do, with the file
+type fileResult int
+
+const (
+	fileUnchanged fileResult = iota
+	fileCreated
+	fileUpdated
+	fileModeChanged
+)
+
+func fileModeHandlingInternal(ctx context.Context, provider api.Provider, settings internal.Settings, logger *log.Logger) (fileResult, error) {
 	exists, dir := testTargetFolder(settings.OutFile)
 	if !exists {
-		return false, fmt.Errorf("Target folder %v doesn't exists", dir)
+		// A dry run doesn't create the folders of the synced folder
+		if settings.DryRun && settings.OutFolder != "" {
+			return fileCreated, nil
+		}
+		return fileUnchanged, fmt.Errorf("Target folder %v doesn't exists", dir)
 	}
 
-	gitLapFile, err := api.GetFile(settings)
+	perm, err := settings.FilePerm()
 	if err != nil {
-		return false, fmt.Errorf("API Call error: %v", err)
+		return fileUnchanged, err
 	}
 
-	fileData, err := base64.StdEncoding.DecodeString(gitLapFile.Content)
+	local, err := fileHashes(settings.OutFile)
 	if err != nil {
-		return false, fmt.Errorf("DecodeString: %v", err)
+		return fileUnchanged, fmt.Errorf("fileHashes: %v", err)
 	}
 
-	isEqual, err := isOldFileEqual(gitLapFile, settings)
-	if err != nil {
-		return false, fmt.Errorf("isOldFileEqual: %v", err)
+	result := fileUpdated
+	if _, err := os.Lstat(settings.OutFile); os.IsNotExist(err) {
+		result = fileCreated
 	}
 
-	if isEqual {
-		return false, nil
+	if result == fileCreated && settings.DryRun {
+		return result, nil
 	}
 
-	err = os.WriteFile(settings.OutFile, fileData, 0644)
-	if err != nil {
-		return false, fmt.Errorf("WriteFile: %v", err)
+	// The hash of the remote file from its metadata avoids downloading unchanged files. Without a match
+	// a dry run downloads too, the metadata of an LFS file is the one of its pointer and only the pointer
+	// is downloaded if its oid is the hash of the local file.
+	if result == fileUpdated {
+		metadata, err := provider.GetFileMetadata(ctx, settings)
+		switch {
+		case err != nil:
+			logger.Println("No metadata for", settings.RepoFilePath, ", download to compare:", err)
+		case metadata.Matches(local):
+			return updateMode(settings, perm)
+		}
 	}
-	return true, nil
-}
 
-func isOldFileEqual(gitLapFile api.GitLapFile, settings internal.Settings) (bool, error) {
-	if _, err := os.Stat(settings.OutFile); err == nil {
-		file, err := os.Open(settings.OutFile)
+	// Streamed into the temporary file while hashing, a dry run only hashes
+	var tmp *atomicFile
+	var w io.Writer = io.Discard
+	if !settings.DryRun {
+		tmp, err = createAtomic(settings.OutFile)
 		if err != nil {
-			return false, err
+			return fileUnchanged, fmt.Errorf("createAtomic: %v", err)
+		}
+		w = tmp
+	}
+	remoteSha256, err := download(ctx, provider, settings, w, local.ContentSha256)
+	if err != nil {
+		if tmp != nil {
+			tmp.abort()
 		}
-		defer file.Close()
-		hash := sha256.New()
-		if _, err := io.Copy(hash, file); err != nil {
-			return false, err
+		return fileUnchanged, fmt.Errorf("API Call error: %v", err)
+	}
+
+	if remoteSha256 == local.ContentSha256 {
+		if tmp != nil {
+			tmp.abort()
 		}
-		sha256Hex := hex.EncodeToString(hash.Sum(nil))
+		return updateMode(settings, perm)
+	}
+	if settings.DryRun {
+		return result, nil
+	}
 
-		return sha256Hex == gitLapFile.ContentSha256, nil
+	commit := tmp.commitKeepPerm
+	if isModeManaged(settings) {
+		commit = func() error { return tmp.commit(perm) }
 	}
-	return false, nil
+	if err := commit(); err != nil {
+		return fileUnchanged, fmt.Errorf("commit: %w", err)
+	}
+	return result, nil
+}
+
+// updateMode sets the permissions of the unchanged settings.OutFile to perm, if the mode is managed
+func updateMode(settings internal.Settings, perm os.FileMode) (fileResult, error) {
+	if !isModeManaged(settings) {
+		return fileUnchanged, nil
+	}
+	info, err := os.Stat(settings.OutFile)
+	if err != nil {
+		return fileUnchanged, err
+	}
+	if info.Mode().Perm() == perm {
+		return fileUnchanged, nil
+	}
+	if settings.DryRun {
+		return fileModeChanged, nil
+	}
+	if err := os.Chmod(settings.OutFile, perm); err != nil {
+		return fileUnchanged, fmt.Errorf("Chmod: %v", err)
+	}
+	return fileModeChanged, nil
+}
+
+// isModeManaged returns whether the permissions of an existing file are updated. That's the case if
+// the git mode is known or the mode is set explicitly, but not on Windows which has no such permissions.
+func isModeManaged(settings internal.Settings) bool {
+	if runtime.GOOS == "windows" {
+		return false
+	}
+	return settings.RepoFileMode != "" || settings.FileMode != ""
 }
 
 func testTargetFolder(outFile string) (bool, string) {
@@ -234,17 +619,83 @@ func testTargetFolder(outFile string) (bool, string) {
 }
 
 func getSettingsFromFlags() internal.Settings {
-	return internal.Settings{
-		PrivateToken:   *flagTokenPtr,
-		OutFile:        *flagOutPathPtr,
-		OutFolder:      *flagOutFolderPtr,
-		Branch:         *flagBranchPtr,
-		ApiUrl:         *flagUrlPtr,
-		ProjectNumber:  strconv.Itoa(*flagProjectNumberPtr),
-		RepoFilePath:   *flagRepoFilePathPar,
-		RepoFolderPath: *flagRepoFolderPathPtr,
-		UserAgent:      AppName + " " + version,
-		IncludeOnly:    *flagIncludeOnlyPtr,
-		Exclude:        *flagExcludePtr,
+	settings := internal.Settings{
+		Provider:         *flagProviderPtr,
+		PrivateToken:     tokenFromFlagOrEnv(),
+		TokenFile:        *flagTokenFilePtr,
+		CredentialHelper: *flagCredentialHelperPtr,
+		AuthType:         *flagAuthTypePtr,
+		Username:         *flagUsernamePtr,
+		OutFile:          *flagOutPathPtr,
+		OutFolder:        *flagOutFolderPtr,
+		Ref:              refFromFlags(),
+		ApiUrl:           *flagUrlPtr,
+		GitCache:         *flagGitCachePtr,
+		ProjectNumber:    projectFromFlags(),
+		RepoFilePath:     *flagRepoFilePathPar,
+		RepoFolderPath:   *flagRepoFolderPathPtr,
+		UserAgent:        AppName + " " + version,
+		IncludeOnly:      *flagIncludeOnlyPtr,
+		Exclude:          *flagExcludePtr,
+		Insecure:         *flagInsecurePtr,
+		CACertFile:       *flagCACertFilePtr,
+		ClientCertFile:   *flagClientCertFilePtr,
+		ClientKeyFile:    *flagClientKeyFilePtr,
+		TLSMinVersion:    *flagTLSMinVersionPtr,
+		ConnectTimeout:   *flagConnectTimeoutPtr,
+		Timeout:          *flagTimeoutPtr,
+		Retries:          *flagRetriesPtr,
+		RetryWait:        *flagRetryWaitPtr,
+		RetryMaxWait:     *flagRetryMaxWaitPtr,
+		Parallel:         *flagParallelPtr,
+		Delete:           *flagDeletePtr,
+		FileMode:         *flagFileModePtr,
+		DirMode:          *flagDirModePtr,
+		Submodules:       *flagSubmodulesPtr,
+		OnChange:         *flagOnChangePtr,
+		OnFileChange:     *flagOnFileChangePtr,
+		HookTimeout:      *flagHookTimeoutPtr,
+		Rollback:         *flagRollbackPtr,
+		DryRun:           *flagDryRunPtr,
+		PlanFormat:       *flagPlanFormatPtr,
+	}
+	return settings.WithProjectUrl().WithProviderDefaults().WithCIDefaults()
+}
+
+// refFromFlags returns -ref, otherwise -branch
+func refFromFlags() string {
+	if *flagRefPtr != "" {
+		return *flagRefPtr
+	}
+	return *flagBranchPtr
+}
+
+// logAvailableBranches logs the branches of the project as hint for a wrong ref
+func logAvailableBranches(ctx context.Context, provider api.Provider, settings internal.Settings) {
+	branches, err := provider.GetBranches(ctx, settings)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, branch := range branches {
+		names = append(names, branch.Name)
+	}
+	log.Println("Available branches:", names)
+}
+
+// projectFromFlags returns -project, otherwise -projectNumber
+func projectFromFlags() string {
+	if *flagProjectPtr != "" {
+		return *flagProjectPtr
+	}
+	return strconv.Itoa(*flagProjectNumberPtr)
+}
+
+// tokenFromFlagOrEnv returns the token of -token, otherwise the token of the environment
+func tokenFromFlagOrEnv() string {
+	if *flagTokenPtr != "" {
+		log.Println("Warning:", internal.FlagNameToken, "is visible in the process list, use", internal.EnvToken, "or", internal.FlagNameTokenFile)
+		return *flagTokenPtr
 	}
+	return internal.TokenFromEnv(*flagProviderPtr)
 }
@@ -2,10 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -14,11 +22,62 @@ import (
 	"github.com/pkg/errors"
 )
 
+func TestMain(m *testing.M) {
+	api.HttpStreamFunc = rawFromJsonMock
+	api.HttpHeadFunc = headFromJsonMock
+	os.Exit(m.Run())
+}
+
+// headFromJsonMock answers HEAD requests with the headers GitLab derives from the JSON response of the
+// current api.HttpGetFunc mock
+func headFromJsonMock(ctx context.Context, c *http.Client, url string, s internal.Settings) (http.Header, error) {
+	body, _, err := api.HttpGetFunc(ctx, c, url, s)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		ContentSha256 string `json:"content_sha256"`
+		BlobID        string `json:"blob_id"`
+	}
+	if err := json.Unmarshal(body, &file); err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("X-Gitlab-Content-Sha256", file.ContentSha256)
+	header.Set("X-Gitlab-Blob-Id", file.BlobID)
+	return header, nil
+}
+
+// rawFromJsonMock answers raw file requests with the content of the JSON response of the current
+// api.HttpGetFunc mock, so the mocks of the tests serve both endpoints
+func rawFromJsonMock(ctx context.Context, c *http.Client, url string, s internal.Settings) (io.ReadCloser, http.Header, error) {
+	body, header, err := api.HttpGetFunc(ctx, c, strings.Replace(url, "/raw?", "?", 1), s)
+	if err != nil {
+		return nil, nil, err
+	}
+	var file api.GitLapFile
+	if err := json.Unmarshal(body, &file); err != nil {
+		return nil, nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), header, nil
+}
+
 func Test_main_no_arguments(t *testing.T) {
+	setFlagsNone()
+
+	var exitCode int
 	output := captureOutput(func() {
-		main()
+		exitCode = mainSub()
 	})
 
+	if exitCode != ExitInvalidArgs {
+		t.Errorf("mainSub() = %v, want %v", exitCode, ExitInvalidArgs)
+	}
+
 	fmt.Println(output)
 
 	expected := "Arguments are missing"
@@ -27,6 +86,25 @@ func Test_main_no_arguments(t *testing.T) {
 	}
 }
 
+func Test_main_unknown_flag(t *testing.T) {
+	setFlagsNone()
+	args := os.Args
+	var output bytes.Buffer
+	flag.CommandLine.SetOutput(&output)
+	defer func() {
+		os.Args = args
+		flag.CommandLine.SetOutput(nil)
+	}()
+	os.Args = []string{"gdown", "-outPth", "wg0.conf"}
+
+	if exitCode := mainSub(); exitCode != ExitInvalidArgs {
+		t.Errorf("mainSub() = %v, want %v", exitCode, ExitInvalidArgs)
+	}
+	if !strings.Contains(output.String(), "flag provided but not defined: -outPth") {
+		t.Errorf("flag output = \"%v\", want the unknown flag", output.String())
+	}
+}
+
 func Test_main_mode_file(t *testing.T) {
 	filePath, err := getTempFilePath()
 	if err != nil {
@@ -34,52 +112,23 @@ func Test_main_mode_file(t *testing.T) {
 	}
 
 	setFlagsFile(filePath)
-
-	api.HttpGetFunc = func(url string, s internal.Settings) ([]byte, error) {
-		file := `{
-			"file_name": "settings.json",
-			"file_path": "settings.json",
-			"size": 66,
-			"encoding": "base64",
-			"content_sha256": "3de0a34a2cd8d60061f9ac2feda73053b0b8de80995d3fd167c2c225f73817a4",
-			"ref": "master",
-			"blob_id": "3bb802a168cc02233c337503990b8d906619583b",
-			"commit_id": "726a84679597812d8085085f742fb5ddba8a0299",
-			"last_commit_id": "4005048b4c3d556ebcdb40bd7dc471fd2216d635",
-			"content": "ewogICAgImZydWl0IjogIkFwcGxlIiwKICAgICJzaXplIjogIkxhcmdlIiwKICAgICJjb2xvciI6ICJSZWQiCn0K"
-		}`
-
-		branches := `[
-			{
-				"name": "BUG-FIX"
-			},
-			{
-				"name": "master"
-			}
-		]`
-
-		if strings.Contains(url, "/repository/branches") {
-			return []byte(branches), nil
-		}
-		if strings.Contains(url, "/repository/files") {
-			return []byte(file), nil
-		}
-		return nil, errors.New("Unknown TESTING URL")
-	}
+	mockFileApi()
 
 	var output string
 
 	tests := []struct {
-		name        string
-		prepare     func()
-		wantContent []string
+		name         string
+		prepare      func()
+		wantContent  []string
+		wantExitCode int
 	}{
 		{
 			name: "New File",
 			prepare: func() {
 
 			},
-			wantContent: []string{"Wrote"},
+			wantContent:  []string{"Wrote"},
+			wantExitCode: ExitChanged,
 		},
 		{
 			name: "Diff File",
@@ -92,7 +141,8 @@ func Test_main_mode_file(t *testing.T) {
 				f.Write([]byte("Add some content to file to create a different hash"))
 				f.Close()
 			},
-			wantContent: []string{"Wrote"},
+			wantContent:  []string{"Wrote"},
+			wantExitCode: ExitChanged,
 		},
 		{
 			name: "No Diff File",
@@ -104,7 +154,8 @@ func Test_main_mode_file(t *testing.T) {
 				f.Write(getContent())
 				f.Close()
 			},
-			wantContent: []string{"Skip"},
+			wantContent:  []string{"Skip"},
+			wantExitCode: ExitUnchanged,
 		},
 	}
 
@@ -112,10 +163,15 @@ func Test_main_mode_file(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.prepare()
 
+			var exitCode int
 			output = captureOutput(func() {
-				main()
+				exitCode = mainSub()
 			})
 
+			if exitCode != tt.wantExitCode {
+				t.Errorf("mainSub() = %v, want %v", exitCode, tt.wantExitCode)
+			}
+
 			for _, line := range tt.wantContent {
 				if !strings.Contains(output, line) {
 					t.Errorf("main() got console output = \"%v\", want \"%v\"", output, line)
@@ -136,7 +192,7 @@ func Test_main_mode_folder(t *testing.T) {
 
 	setFlagsFolder(folder)
 
-	api.HttpGetFunc = func(url string, s internal.Settings) ([]byte, error) {
+	api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
 		if strings.Contains(url, `/repository/tree/?ref=master`) {
 			return []byte(`[
 				{
@@ -146,7 +202,7 @@ func Test_main_mode_folder(t *testing.T) {
 					"path": "test_dir/file1.txt",
 					"mode": "100644"
 				}
-			]`), nil
+			]`), nil, nil
 		}
 		if strings.Contains(url, `repository/files/test_dir%2Ffile1.txt?ref=master`) {
 			return []byte(`{
@@ -160,7 +216,7 @@ func Test_main_mode_folder(t *testing.T) {
 				"commit_id": "726a84679597812d8085085f742fb5ddba8a0299",
 				"last_commit_id": "9bc24ea56f8862e5964c9f4ee71dab7396902b9f",
 				"content": "VGVzdCBGaWxlIDEK"
-			}`), nil
+			}`), nil, nil
 		}
 		if strings.Contains(url, `repository/branches`) {
 			return []byte(`[
@@ -170,9 +226,9 @@ func Test_main_mode_folder(t *testing.T) {
 			{
 				"name": "master"
 			}
-		]`), nil
+		]`), nil, nil
 		}
-		return nil, fmt.Errorf("Unknown TEST-URL %v", url)
+		return nil, nil, fmt.Errorf("Unknown TEST-URL %v", url)
 	}
 
 	var output string
@@ -196,7 +252,7 @@ func Test_main_mode_folder(t *testing.T) {
 			tt.prepare()
 
 			output = captureOutput(func() {
-				main()
+				mainSub()
 			})
 
 			for _, line := range tt.wantContent {
@@ -214,6 +270,218 @@ func Test_main_mode_folder(t *testing.T) {
 	}
 }
 
+func Test_main_mode_folder_recursive(t *testing.T) {
+	folder, err := getTempFolderPath()
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(folder)
+
+	setFlagsFolder(folder)
+	exclude := "^skip"
+	flagExcludePtr = &exclude
+	defer func() {
+		noExclude := ""
+		flagExcludePtr = &noExclude
+	}()
+
+	var treeRequests int
+	api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+		if strings.Contains(url, `/repository/tree/?ref=master`) {
+			treeRequests++
+			if !strings.Contains(url, "recursive=true") {
+				return nil, nil, fmt.Errorf("Expected recursive listing %v", url)
+			}
+			// Unsorted on purpose, folders must be created before their files
+			return []byte(`[
+				{"id": "a1", "name": "file2.txt", "type": "blob", "path": "test_dir/sub/deep/file2.txt", "mode": "100644"},
+				{"id": "a2", "name": "sub", "type": "tree", "path": "test_dir/sub", "mode": "040000"},
+				{"id": "a3", "name": "deep", "type": "tree", "path": "test_dir/sub/deep", "mode": "040000"},
+				{"id": "a4", "name": "file1.txt", "type": "blob", "path": "test_dir/file1.txt", "mode": "100644"},
+				{"id": "a5", "name": "skipped", "type": "tree", "path": "test_dir/skipped", "mode": "040000"},
+				{"id": "a6", "name": "file3.txt", "type": "blob", "path": "test_dir/skipped/file3.txt", "mode": "100644"}
+			]`), nil, nil
+		}
+		if strings.Contains(url, `repository/files/`) {
+			return []byte(`{
+				"file_name": "file.txt",
+				"content_sha256": "11c014f2e9aa58bb56e6a489298ea61a3903c3e632c5aaec5d135996cab0b24e",
+				"content": "VGVzdCBGaWxlIDEK"
+			}`), nil, nil
+		}
+		if strings.Contains(url, `repository/branches`) {
+			return []byte(`[{"name": "master"}]`), nil, nil
+		}
+		return nil, nil, fmt.Errorf("Unknown TEST-URL %v", url)
+	}
+
+	output := captureOutput(func() {
+		mainSub()
+	})
+
+	if treeRequests != 1 {
+		t.Errorf("expected 1 tree request, got %v", treeRequests)
+	}
+	for _, want := range []string{"file1.txt", filepath.Join("sub", "deep", "file2.txt")} {
+		if !exists(filepath.Join(folder, want)) {
+			t.Errorf("expected %v to be written, output: %v", want, output)
+		}
+	}
+	if exists(filepath.Join(folder, "skipped")) {
+		t.Errorf("expected excluded folder not to be created, output: %v", output)
+	}
+	if !strings.Contains(output, "Skip: skipped because exclude rule") {
+		t.Errorf("main() got console output = \"%v\", want skip of excluded folder", output)
+	}
+	log.SetOutput(nil)
+}
+
+func Test_main_mode_folder_file_mode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no file permissions on windows")
+	}
+
+	folder, err := getTempFolderPath()
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(folder)
+
+	setFlagsFolder(folder)
+
+	api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+		if strings.Contains(url, `/repository/tree/?ref=master`) {
+			return []byte(`[
+				{"id": "a1", "name": "run.sh", "type": "blob", "path": "test_dir/run.sh", "mode": "100755"},
+				{"id": "a2", "name": "file1.txt", "type": "blob", "path": "test_dir/file1.txt", "mode": "100644"}
+			]`), nil, nil
+		}
+		if strings.Contains(url, `repository/files/`) {
+			return []byte(`{
+				"file_name": "file.txt",
+				"content_sha256": "11c014f2e9aa58bb56e6a489298ea61a3903c3e632c5aaec5d135996cab0b24e",
+				"content": "VGVzdCBGaWxlIDEK"
+			}`), nil, nil
+		}
+		if strings.Contains(url, `repository/branches`) {
+			return []byte(`[{"name": "master"}]`), nil, nil
+		}
+		return nil, nil, fmt.Errorf("Unknown TEST-URL %v", url)
+	}
+
+	wantPerms := func() {
+		for name, want := range map[string]os.FileMode{"run.sh": 0755, "file1.txt": 0644} {
+			info, err := os.Stat(filepath.Join(folder, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != want {
+				t.Errorf("mode of %v = %v, want %v", name, info.Mode().Perm(), want)
+			}
+		}
+	}
+
+	captureOutput(func() {
+		mainSub()
+	})
+	wantPerms()
+
+	// Same content, only the executable bit is lost
+	if err := os.Chmod(filepath.Join(folder, "run.sh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := captureOutput(func() {
+		mainSub()
+	})
+	wantPerms()
+
+	if !strings.Contains(output, "Changed mode: test_dir/run.sh") {
+		t.Errorf("main() got console output = \"%v\", want mode change of run.sh", output)
+	}
+	if !strings.Contains(output, "Skip: test_dir/file1.txt") {
+		t.Errorf("main() got console output = \"%v\", want skip of file1.txt", output)
+	}
+	log.SetOutput(nil)
+}
+
+func Test_main_exit_code_error(t *testing.T) {
+	filePath, err := getTempFilePath()
+	if err != nil {
+		t.Error(err)
+	}
+
+	setFlagsFile(filePath)
+
+	api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+		if strings.Contains(url, "/repository/branches") {
+			return []byte(`[{"name": "master"}]`), nil, nil
+		}
+		return nil, nil, &api.HttpError{StatusCode: http.StatusNotFound}
+	}
+
+	var exitCode int
+	captureOutput(func() {
+		exitCode = mainSub()
+	})
+
+	if exitCode != ExitError {
+		t.Errorf("mainSub() = %v, want %v", exitCode, ExitError)
+	}
+	log.SetOutput(nil)
+}
+
+func Test_relativeRepoPath(t *testing.T) {
+	tests := []struct {
+		folder string
+		path   string
+		want   string
+	}{
+		{folder: "test_dir", path: "test_dir/a/b.txt", want: "a/b.txt"},
+		{folder: "/test_dir/", path: "test_dir/b.txt", want: "b.txt"},
+		{folder: "/", path: "a/b.txt", want: "a/b.txt"},
+	}
+	for _, tt := range tests {
+		if got := relativeRepoPath(tt.folder, tt.path); got != tt.want {
+			t.Errorf("relativeRepoPath(%v, %v) = %v, want %v", tt.folder, tt.path, got, tt.want)
+		}
+	}
+}
+
+// mockFileApi mocks https://gitlab.com/gdown/test-project/blob/master/settings.json
+func mockFileApi() {
+	api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+		file := `{
+			"file_name": "settings.json",
+			"file_path": "settings.json",
+			"size": 66,
+			"encoding": "base64",
+			"content_sha256": "3de0a34a2cd8d60061f9ac2feda73053b0b8de80995d3fd167c2c225f73817a4",
+			"ref": "master",
+			"blob_id": "3bb802a168cc02233c337503990b8d906619583b",
+			"commit_id": "726a84679597812d8085085f742fb5ddba8a0299",
+			"last_commit_id": "4005048b4c3d556ebcdb40bd7dc471fd2216d635",
+			"content": "ewogICAgImZydWl0IjogIkFwcGxlIiwKICAgICJzaXplIjogIkxhcmdlIiwKICAgICJjb2xvciI6ICJSZWQiCn0K"
+		}`
+
+		branches := `[
+			{
+				"name": "BUG-FIX"
+			},
+			{
+				"name": "master"
+			}
+		]`
+
+		if strings.Contains(url, "/repository/branches") {
+			return []byte(branches), nil, nil
+		}
+		if strings.Contains(url, "/repository/files") {
+			return []byte(file), nil, nil
+		}
+		return nil, nil, errors.New("Unknown TESTING URL")
+	}
+}
+
 func getTempFilePath() (string, error) {
 	tmpfileTarget, _ := os.CreateTemp("", "golang-test.*")
 	filePath := tmpfileTarget.Name()
@@ -261,6 +529,19 @@ func setFlagsFile(path string) {
 	flagBranchPtr = &branch
 }
 
+func setFlagsNone() {
+	empty := ""
+	flagRepoFilePathPar = &empty
+	flagOutPathPtr = &empty
+	flagRepoFolderPathPtr = &empty
+	flagOutFolderPtr = &empty
+	flagUrlPtr = &empty
+	flagTokenPtr = &empty
+
+	projectNumber := 0
+	flagProjectNumberPtr = &projectNumber
+}
+
 func setFlagsFolder(folder string) {
 	filePath := ""
 	flagRepoFilePathPar = &filePath
@@ -306,3 +587,101 @@ func getContent() []byte {
 
 	return data
 }
+
+func Test_main_config(t *testing.T) {
+	folder := t.TempDir()
+	configPath := filepath.Join(folder, "gdown.json")
+	config := fmt.Sprintf(`{"sources": [{
+		"url": "https://gitlab.com/api/v4/",
+		"token": "5BUJpxdVx9fyq5KrXJx6",
+		"project": 16447351,
+		"ref": "master",
+		"mappings": [
+			{"repoFile": "settings.json", "outPath": %q},
+			{"repoFile": "settings.json", "outPath": %q}
+		]
+	}]}`, filepath.Join(folder, "a.json"), filepath.Join(folder, "b.json"))
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	setFlagsNone()
+	flagConfigPtr = &configPath
+	defer func() {
+		empty := ""
+		flagConfigPtr, flagOutPathPtr = &empty, &empty
+	}()
+	mockFileApi()
+
+	var exitCode int
+	output := captureOutput(func() {
+		exitCode = mainSub()
+	})
+
+	if exitCode != ExitChanged {
+		t.Errorf("mainSub() = %v, want %v\n%v", exitCode, ExitChanged, output)
+	}
+	for _, name := range []string{"a.json", "b.json"} {
+		data, err := os.ReadFile(filepath.Join(folder, name))
+		if err != nil || !bytes.Equal(data, getContent()) {
+			t.Errorf("%v = %q, %v, want the content of settings.json", name, data, err)
+		}
+	}
+
+	// Mappings and the file flags exclude each other
+	outPath := filepath.Join(folder, "c.json")
+	flagOutPathPtr = &outPath
+	captureOutput(func() {
+		exitCode = mainSub()
+	})
+	if exitCode != ExitInvalidArgs {
+		t.Errorf("mainSub() with %v and %v = %v, want %v", internal.FlagNameConfig, internal.FlagNameOutPath, exitCode, ExitInvalidArgs)
+	}
+}
+
+func Test_folderModeHandling_git(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	repo := filepath.Join(t.TempDir(), "config")
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=gdown", "-c", "user.email=gdown@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, output)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(repo, "conf"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "conf", "wg0.conf"), []byte("[Interface]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "Initial")
+	git("tag", "v1.0")
+
+	outFolder := filepath.Join(t.TempDir(), "out")
+	settings := internal.Settings{ApiUrl: "file:///" + strings.TrimPrefix(filepath.ToSlash(repo), "/"), Ref: "v1.0", RepoFolderPath: "conf", OutFolder: outFolder}.WithProviderDefaults()
+	provider, err := api.NewProvider(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.ResolveRef(context.Background(), settings); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := folderModeHandling(context.Background(), provider, settings)
+	if err != nil || len(changedOnly(changes)) != 1 {
+		t.Fatalf("folderModeHandling() = %+v, %v, want 1 change", changes, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(outFolder, "wg0.conf")); err != nil || string(data) != "[Interface]\n" {
+		t.Errorf("wg0.conf = %q, %v", data, err)
+	}
+
+	// The blob ID of the tree matches the local file, nothing is downloaded again
+	changes, err = folderModeHandling(context.Background(), provider, settings)
+	if err != nil || len(changedOnly(changes)) != 0 {
+		t.Errorf("folderModeHandling() second run = %+v, %v, want no change", changes, err)
+	}
+}
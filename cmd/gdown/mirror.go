@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+// deleteNotInRemote removes files and empty folders below settings.OutFolder which are not in the
+// remote listing. Local files skipped by the include only or exclude rule are kept. It returns the
+// deleted files, with settings.DryRun the files which would be deleted.
+func deleteNotInRemote(settings internal.Settings, files []api.RepoFile) ([]change, []error) {
+	// An empty listing is more likely a wrong folder or ref than an empty remote folder
+	if len(files) == 0 {
+		log.Println("Skip delete: remote folder", settings.RepoFolderPath, "is empty")
+		return nil, nil
+	}
+
+	remote := map[string]bool{}
+	submodules := map[string]bool{}
+	for _, file := range files {
+		rel := relativeRepoPath(settings.RepoFolderPath, file.Path)
+		remote[rel] = true
+		if file.Type == "commit" {
+			submodules[rel] = true
+		}
+	}
+
+	verb := "Deleted"
+	if settings.DryRun {
+		verb = "Would delete"
+	}
+
+	var deleted []change
+	var errs []error
+	// removed is used instead of the content of the folders, so a dry run sees the same empty folders
+	removed := map[string]bool{}
+	var folders []string
+	err := filepath.WalkDir(settings.OutFolder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == settings.OutFolder {
+			return nil
+		}
+
+		rel, err := filepath.Rel(settings.OutFolder, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		// Backups are needed for a rollback until the end of the run
+		if !d.IsDir() && strings.HasSuffix(rel, backupSuffix) {
+			return nil
+		}
+
+		// Submodules are mirrored by their own sync or not managed at all
+		if filterReason(settings, path.Base(rel)) != "" || submodules[rel] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if !remote[rel] {
+				folders = append(folders, p)
+			}
+			return nil
+		}
+
+		if remote[rel] {
+			return nil
+		}
+		if !settings.DryRun {
+			if err := os.Remove(p); err != nil {
+				log.Println("Error:", err)
+				errs = append(errs, fmt.Errorf("delete %v: %w", rel, err))
+				return nil
+			}
+		}
+		removed[p] = true
+		log.Println(verb, "file:", rel, ", because not in remote folder")
+		deleted = append(deleted, change{action: actionDelete, outFile: p, repoFile: path.Join(settings.RepoFolderPath, rel), reason: "not in remote folder"})
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// Deepest folders first, so parents become empty
+	sort.Sort(sort.Reverse(sort.StringSlice(folders)))
+	for _, folder := range folders {
+		if !isEmptyAfterDelete(folder, removed) {
+			continue
+		}
+		rel, _ := filepath.Rel(settings.OutFolder, folder)
+		if !settings.DryRun {
+			if err := os.Remove(folder); err != nil {
+				log.Println("Error:", err)
+				errs = append(errs, fmt.Errorf("delete %v: %w", rel, err))
+				continue
+			}
+		}
+		removed[folder] = true
+		log.Println(verb, "folder:", filepath.ToSlash(rel), ", because not in remote folder")
+		deleted = append(deleted, change{action: actionDelete, outFile: folder, repoFile: path.Join(settings.RepoFolderPath, filepath.ToSlash(rel)), reason: "not in remote folder"})
+	}
+
+	return deleted, errs
+}
+
+// isEmptyAfterDelete returns whether folder contains nothing but removed entries
+func isEmptyAfterDelete(folder string, removed map[string]bool) bool {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !removed[filepath.Join(folder, entry.Name())] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+func Test_deleteNotInRemote(t *testing.T) {
+	folder := t.TempDir()
+	for _, file := range []string{
+		"keep.txt",
+		"old.txt",
+		"local.bak",
+		"sub/keep.txt",
+		"sub/old.txt",
+		"gone/deep/old.txt",
+		"backup.bak/old.txt",
+	} {
+		p := filepath.Join(folder, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings := internal.Settings{
+		OutFolder:      folder,
+		RepoFolderPath: "test_dir",
+		Exclude:        `\.bak$`,
+	}
+	remote := []api.RepoFile{
+		{Name: "keep.txt", Type: "blob", Path: "test_dir/keep.txt"},
+		{Name: "sub", Type: "tree", Path: "test_dir/sub"},
+		{Name: "keep.txt", Type: "blob", Path: "test_dir/sub/keep.txt"},
+	}
+
+	var errs []error
+	captureOutput(func() {
+		_, errs = deleteNotInRemote(settings, remote)
+	})
+	if len(errs) != 0 {
+		t.Fatalf("deleteNotInRemote() errors = %v", errs)
+	}
+
+	for file, want := range map[string]bool{
+		"keep.txt":           true,
+		"old.txt":            false,
+		"local.bak":          true,
+		"sub/keep.txt":       true,
+		"sub/old.txt":        false,
+		"gone":               false,
+		"backup.bak/old.txt": true,
+	} {
+		if got := exists(filepath.Join(folder, filepath.FromSlash(file))); got != want {
+			t.Errorf("exists(%v) = %v, want %v", file, got, want)
+		}
+	}
+}
+
+func Test_deleteNotInRemote_EmptyListing(t *testing.T) {
+	folder := t.TempDir()
+	file := filepath.Join(folder, "file.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	captureOutput(func() {
+		deleteNotInRemote(internal.Settings{OutFolder: folder, RepoFolderPath: "test_dir"}, nil)
+	})
+
+	if !exists(file) {
+		t.Error("expected no delete for an empty remote listing")
+	}
+}
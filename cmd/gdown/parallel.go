@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+)
+
+// job is one step of a folder sync. Its log output is buffered, so runJobs can write it in the
+// order of the jobs regardless of the order in which the workers finish.
+type job struct {
+	run     func(logger *log.Logger) ([]change, error)
+	output  bytes.Buffer
+	changes []change
+	err     error
+	done    chan struct{}
+}
+
+// newJob creates a job, run returns the local files it changed
+func newJob(run func(logger *log.Logger) ([]change, error)) *job {
+	return &job{run: run, done: make(chan struct{})}
+}
+
+// runJobs runs the jobs with at most parallel workers and writes their log output in order.
+// Jobs not started before ctx is canceled are skipped. It returns the changes and the errors of all jobs.
+func runJobs(ctx context.Context, parallel int, jobs []*job) ([]change, []error) {
+	queue := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < max(parallel, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				if ctx.Err() == nil {
+					j.changes, j.err = j.run(log.New(&j.output, log.Prefix(), log.Flags()))
+				}
+				close(j.done)
+			}
+		}()
+	}
+
+	go func() {
+		for _, j := range jobs {
+			queue <- j
+		}
+		close(queue)
+	}()
+
+	var changes []change
+	var errs []error
+	for _, j := range jobs {
+		<-j.done
+		log.Writer().Write(j.output.Bytes())
+		changes = append(changes, j.changes...)
+		if j.err != nil {
+			errs = append(errs, j.err)
+		}
+	}
+	wg.Wait()
+
+	return changes, errs
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_runJobs(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	var jobs []*job
+	for i := 0; i < 10; i++ {
+		jobs = append(jobs, newJob(func(logger *log.Logger) ([]change, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+
+			// Later jobs finish first
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+			logger.Println("job", i)
+			if i%3 == 0 {
+				return nil, fmt.Errorf("error %v", i)
+			}
+			if i == 4 {
+				return []change{{outFile: "file4"}}, nil
+			}
+			return nil, nil
+		}))
+	}
+
+	var changes []change
+	var errs []error
+	output := captureOutput(func() {
+		changes, errs = runJobs(context.Background(), 3, jobs)
+	})
+
+	if len(changes) != 1 || changes[0].outFile != "file4" {
+		t.Errorf("runJobs() changes = %v, want file4", changes)
+	}
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		want = append(want, fmt.Sprint("job ", i))
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("runJobs() output = %v, want %v lines", output, len(want))
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, want[i]) {
+			t.Errorf("runJobs() line %v = %v, want %v", i, line, want[i])
+		}
+	}
+
+	if len(errs) != 4 || errs[0].Error() != "error 0" || errs[3].Error() != "error 9" {
+		t.Errorf("runJobs() errors = %v, want error 0, 3, 6 and 9", errs)
+	}
+	if maxRunning.Load() > 3 {
+		t.Errorf("runJobs() ran %v jobs in parallel, want at most 3", maxRunning.Load())
+	}
+}
+
+func Test_runJobs_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ran := false
+	_, errs := runJobs(ctx, 2, []*job{newJob(func(logger *log.Logger) ([]change, error) {
+		ran = true
+		return nil, errors.New("should not run")
+	})})
+
+	if ran || len(errs) != 0 {
+		t.Errorf("runJobs() ran = %v, errors = %v, want no job to run after cancel", ran, errs)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// action is what a run did, or with -dry-run would do, with a local file
+type action string
+
+const (
+	actionCreate action = "create"
+	actionUpdate action = "update"
+	actionDelete action = "delete"
+	actionSkip   action = "skip"
+)
+
+// planOutput is where the json plan is written to, the log is kept separate on stderr
+var planOutput io.Writer = os.Stdout
+
+// changedOnly returns the changes without the skipped files
+func changedOnly(changes []change) []change {
+	var changed []change
+	for _, c := range changes {
+		if c.action != actionSkip {
+			changed = append(changed, c)
+		}
+	}
+	return changed
+}
+
+type planEntry struct {
+	Action    action `json:"action"`
+	RepoFile  string `json:"repoFile"`
+	LocalFile string `json:"localFile,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type plan struct {
+	Changed bool        `json:"changed"`
+	Actions []planEntry `json:"actions"`
+	Errors  []string    `json:"errors"`
+}
+
+// printPlan prints the actions of a dry run in settings.PlanFormat, text is logged and json is
+// written to planOutput
+func printPlan(settings internal.Settings, changes []change, err error) error {
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else if err != nil {
+		errs = []error{err}
+	}
+
+	p := plan{Changed: len(changedOnly(changes)) > 0, Actions: []planEntry{}, Errors: []string{}}
+	counts := map[action]int{}
+	for _, c := range changes {
+		p.Actions = append(p.Actions, planEntry{Action: c.action, RepoFile: c.repoFile, LocalFile: c.outFile, Reason: c.reason})
+		counts[c.action]++
+	}
+	for _, err := range errs {
+		p.Errors = append(p.Errors, err.Error())
+	}
+
+	if settings.PlanFormat == internal.PlanFormatJSON {
+		encoder := json.NewEncoder(planOutput)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(p)
+	}
+
+	log.Println("Plan:", counts[actionCreate], "create,", counts[actionUpdate], "update,", counts[actionDelete], "delete,", counts[actionSkip], "skip,", len(errs), "errors")
+	for _, e := range p.Actions {
+		if e.Reason != "" {
+			log.Println(fmt.Sprintf(" %-6v", e.Action), e.RepoFile, ", because", e.Reason)
+			continue
+		}
+		log.Println(fmt.Sprintf(" %-6v", e.Action), e.RepoFile)
+	}
+	for _, err := range p.Errors {
+		log.Println(" error ", err)
+	}
+	return nil
+}
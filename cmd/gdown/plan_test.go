@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+func Test_main_dry_run(t *testing.T) {
+	folder := t.TempDir()
+	local := map[string]string{
+		"equal.txt":   "equal\n",
+		"changed.txt": "old\n",
+		"old.txt":     "old\n",
+		"skip.log":    "log\n",
+	}
+	for name, content := range local {
+		if err := os.WriteFile(filepath.Join(folder, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote := map[string]string{
+		"test_dir/equal.txt":   "equal\n",
+		"test_dir/changed.txt": "new\n",
+		"test_dir/new.txt":     "new\n",
+		"test_dir/sub/new.txt": "new\n",
+	}
+
+	setFlagsFolder(folder)
+	exclude, deleteFlag, dryRun, planFormat := `\.log$`, true, true, internal.PlanFormatJSON
+	flagExcludePtr, flagDeletePtr, flagDryRunPtr, flagPlanFormatPtr = &exclude, &deleteFlag, &dryRun, &planFormat
+	defer func() {
+		none, no, text := "", false, internal.PlanFormatText
+		flagExcludePtr, flagDeletePtr, flagDryRunPtr, flagPlanFormatPtr = &none, &no, &no, &text
+		planOutput = os.Stdout
+	}()
+
+	api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+		if strings.Contains(url, "/repository/branches") {
+			return []byte(`[{"name": "master"}]`), nil, nil
+		}
+		if strings.Contains(url, "/repository/tree/") {
+			return []byte(`[
+				{"name": "changed.txt", "type": "blob", "path": "test_dir/changed.txt", "mode": "100644"},
+				{"name": "equal.txt", "type": "blob", "path": "test_dir/equal.txt", "mode": "100644"},
+				{"name": "new.txt", "type": "blob", "path": "test_dir/new.txt", "mode": "100644"},
+				{"name": "skip.log", "type": "blob", "path": "test_dir/skip.log", "mode": "100644"},
+				{"name": "sub", "type": "tree", "path": "test_dir/sub", "mode": "040000"},
+				{"name": "new.txt", "type": "blob", "path": "test_dir/sub/new.txt", "mode": "100644"}
+			]`), nil, nil
+		}
+		for repoPath, content := range remote {
+			if strings.Contains(url, "/repository/files/"+strings.ReplaceAll(repoPath, "/", "%2F")+"?") {
+				sum := sha256.Sum256([]byte(content))
+				return []byte(fmt.Sprintf(`{"content_sha256": "%v", "content": "%v"}`, hex.EncodeToString(sum[:]), base64.StdEncoding.EncodeToString([]byte(content)))), nil, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("Unknown TEST-URL %v", url)
+	}
+
+	var stdout bytes.Buffer
+	planOutput = &stdout
+	var exitCode int
+	captureOutput(func() {
+		exitCode = mainSub()
+	})
+
+	if exitCode != ExitChanged {
+		t.Errorf("mainSub() = %v, want %v", exitCode, ExitChanged)
+	}
+
+	var got plan
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("plan is not json: %v\n%v", err, stdout.String())
+	}
+	if !got.Changed || len(got.Errors) > 0 {
+		t.Errorf("plan changed = %v, errors = %v, want changed and no errors", got.Changed, got.Errors)
+	}
+	actions := map[string]action{}
+	for _, e := range got.Actions {
+		actions[e.RepoFile] = e.Action
+	}
+	want := map[string]action{
+		"test_dir/changed.txt": actionUpdate,
+		"test_dir/equal.txt":   actionSkip,
+		"test_dir/new.txt":     actionCreate,
+		"test_dir/skip.log":    actionSkip,
+		"test_dir/sub/new.txt": actionCreate,
+		"test_dir/old.txt":     actionDelete,
+	}
+	for repoFile, wantAction := range want {
+		if actions[repoFile] != wantAction {
+			t.Errorf("plan action of %v = %q, want %q", repoFile, actions[repoFile], wantAction)
+		}
+	}
+	if len(got.Actions) != len(want) {
+		t.Errorf("plan actions = %v, want %v", got.Actions, want)
+	}
+
+	// Nothing is touched
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(local) {
+		t.Errorf("dry run changed the folder, entries = %v", entries)
+	}
+	for name, content := range local {
+		data, err := os.ReadFile(filepath.Join(folder, name))
+		if err != nil || string(data) != content {
+			t.Errorf("dry run changed %v = %q, %v", name, data, err)
+		}
+	}
+}
+
+func Test_printPlan_text(t *testing.T) {
+	changes := []change{
+		{action: actionCreate, repoFile: "a.txt", reason: "it is new"},
+		{action: actionSkip, repoFile: "b.txt", reason: "content is equal"},
+	}
+
+	output := captureOutput(func() {
+		if err := printPlan(internal.Settings{}, changes, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	for _, line := range []string{"Plan: 1 create, 0 update, 0 delete, 1 skip, 0 errors", "create a.txt , because it is new", "skip   b.txt , because content is equal"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("printPlan() output = %q, want %q", output, line)
+		}
+	}
+}
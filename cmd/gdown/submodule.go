@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+// submoduleSettings returns the settings to sync the submodule at file.Path into outFolder. The
+// submodule project is looked up by the url in .gitmodules and must be on the same host and provider.
+// The Git provider has no projects to look it up, so it can't recurse.
+func submoduleSettings(ctx context.Context, provider api.Provider, settings internal.Settings, file api.RepoFile, outFolder string) (internal.Settings, error) {
+	gitmodulesSettings := settings
+	gitmodulesSettings.RepoFilePath = ".gitmodules"
+	gitmodulesSettings.RepoFileID = ""
+	data, err := api.ReadFile(ctx, provider, gitmodulesSettings)
+	if err != nil {
+		return internal.Settings{}, fmt.Errorf("get .gitmodules: %v", err)
+	}
+
+	submoduleUrl, found := parseGitmodules(data)[file.Path]
+	if !found {
+		return internal.Settings{}, fmt.Errorf("submodule %v not found in .gitmodules", file.Path)
+	}
+
+	var superProject string
+	if strings.HasPrefix(submoduleUrl, "./") || strings.HasPrefix(submoduleUrl, "../") {
+		project, err := provider.GetProject(ctx, settings)
+		if err != nil {
+			return internal.Settings{}, fmt.Errorf("get project: %v", err)
+		}
+		superProject = project.PathWithNamespace
+	}
+
+	projectPath, err := submoduleProjectPath(settings.ApiUrl, superProject, submoduleUrl)
+	if err != nil {
+		return internal.Settings{}, err
+	}
+
+	subSettings := settings
+	subSettings.ProjectNumber = projectPath
+	project, err := provider.GetProject(ctx, subSettings)
+	if err != nil {
+		return internal.Settings{}, fmt.Errorf("get submodule project %v: %v", projectPath, err)
+	}
+
+	subSettings.ProjectNumber = project.ID
+	// The tree entry of a submodule is the commit the super project points to
+	subSettings.Ref = file.ID
+	subSettings.RepoFolderPath = ""
+	subSettings.OutFolder = outFolder
+	return subSettings, nil
+}
+
+// parseGitmodules returns the url of every submodule path in a .gitmodules file
+func parseGitmodules(data []byte) map[string]string {
+	urls := map[string]string{}
+	var subPath, subUrl string
+	flush := func() {
+		if subPath != "" && subUrl != "" {
+			urls[subPath] = subUrl
+		}
+		subPath, subUrl = "", ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			flush()
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "path":
+			subPath = strings.TrimSpace(value)
+		case "url":
+			subUrl = strings.TrimSpace(value)
+		}
+	}
+	flush()
+	return urls
+}
+
+// submoduleProjectPath returns the project path like group/project of a submodule url. Relative urls
+// are resolved against superProject, absolute urls must point to the host of apiUrl.
+func submoduleProjectPath(apiUrl, superProject, submoduleUrl string) (string, error) {
+	var projectPath string
+	switch {
+	case strings.HasPrefix(submoduleUrl, "./") || strings.HasPrefix(submoduleUrl, "../"):
+		// Git resolves relative to the url of the super project, so ../ is a sibling project
+		projectPath = path.Join(superProject, submoduleUrl)
+	case !strings.Contains(submoduleUrl, "://") && strings.Contains(submoduleUrl, ":"):
+		// scp-like syntax git@host:group/project.git
+		userHost, p, _ := strings.Cut(submoduleUrl, ":")
+		_, host, found := strings.Cut(userHost, "@")
+		if !found {
+			host = userHost
+		}
+		if err := checkSameHost(apiUrl, host); err != nil {
+			return "", err
+		}
+		projectPath = p
+	default:
+		u, err := url.Parse(submoduleUrl)
+		if err != nil {
+			return "", err
+		}
+		if err := checkSameHost(apiUrl, u.Hostname()); err != nil {
+			return "", err
+		}
+		projectPath = u.Path
+	}
+
+	projectPath = strings.TrimSuffix(strings.Trim(projectPath, "/"), ".git")
+	if projectPath == "" || projectPath == "." || strings.HasPrefix(projectPath, "..") {
+		return "", fmt.Errorf("can't resolve submodule url %v", submoduleUrl)
+	}
+	return projectPath, nil
+}
+
+func checkSameHost(apiUrl, host string) error {
+	u, err := url.Parse(apiUrl)
+	if err != nil {
+		return err
+	}
+	// github.com has its API on api.github.com
+	if !strings.EqualFold(u.Hostname(), host) && !strings.EqualFold(u.Hostname(), "api."+host) {
+		return fmt.Errorf("submodule host %v is not the host %v of the API", host, u.Hostname())
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+func Test_parseGitmodules(t *testing.T) {
+	data := []byte(`[submodule "lib"]
+	path = test_dir/lib
+	url = ../lib.git
+[submodule "other"]
+	url = git@gitlab.com:group/other.git
+	path = other
+[submodule "incomplete"]
+	path = incomplete
+`)
+
+	want := map[string]string{
+		"test_dir/lib": "../lib.git",
+		"other":        "git@gitlab.com:group/other.git",
+	}
+	if got := parseGitmodules(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGitmodules() = %v, want %v", got, want)
+	}
+}
+
+func Test_submoduleProjectPath(t *testing.T) {
+	const apiUrl = "https://gitlab.com/api/v4/"
+
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{url: "../lib.git", want: "gdown/lib"},
+		{url: "./lib", want: "gdown/test-project/lib"},
+		{url: "../../other/lib.git", want: "other/lib"},
+		{url: "../../../lib.git", wantErr: true},
+		{url: "https://gitlab.com/group/sub/lib.git", want: "group/sub/lib"},
+		{url: "ssh://git@gitlab.com:2222/group/lib.git", want: "group/lib"},
+		{url: "git@gitlab.com:group/lib.git", want: "group/lib"},
+		{url: "https://github.com/group/lib.git", wantErr: true},
+		{url: "git@github.com:group/lib.git", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := submoduleProjectPath(apiUrl, "gdown/test-project", tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("submoduleProjectPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("submoduleProjectPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_main_mode_folder_submodule_recurse(t *testing.T) {
+	folder, err := getTempFolderPath()
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(folder)
+
+	setFlagsFolder(folder)
+	recurse := internal.SubmodulesRecurse
+	flagSubmodulesPtr = &recurse
+	defer func() {
+		skip := internal.SubmodulesSkip
+		flagSubmodulesPtr = &skip
+	}()
+
+	gitmodules := base64.StdEncoding.EncodeToString([]byte("[submodule \"lib\"]\n\tpath = test_dir/lib\n\turl = ../lib.git\n"))
+
+	api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+		switch {
+		case strings.Contains(url, `projects/16447351/repository/tree/?ref=master`):
+			return []byte(`[{"id": "0123abc", "name": "lib", "type": "commit", "path": "test_dir/lib", "mode": "160000"}]`), nil, nil
+		case strings.Contains(url, `projects/16447351/repository/files/.gitmodules?ref=master`):
+			return []byte(`{"file_name": ".gitmodules", "content": "` + gitmodules + `"}`), nil, nil
+		case strings.HasSuffix(url, `projects/16447351`):
+			return []byte(`{"id": 16447351, "path_with_namespace": "gdown/test-project"}`), nil, nil
+		case strings.HasSuffix(url, `projects/gdown%2Flib`):
+			return []byte(`{"id": 42, "path_with_namespace": "gdown/lib"}`), nil, nil
+		case strings.Contains(url, `projects/42/repository/tree/?ref=0123abc&path=&`):
+			return []byte(`[{"id": "b1", "name": "lib.txt", "type": "blob", "path": "lib.txt", "mode": "100644"}]`), nil, nil
+		case strings.Contains(url, `projects/42/repository/files/lib.txt?ref=0123abc`):
+			return []byte(`{"file_name": "lib.txt", "content": "VGVzdCBGaWxlIDEK"}`), nil, nil
+		case strings.Contains(url, `repository/branches`):
+			return []byte(`[{"name": "master"}]`), nil, nil
+		}
+		return nil, nil, fmt.Errorf("Unknown TEST-URL %v", url)
+	}
+
+	output := captureOutput(func() {
+		mainSub()
+	})
+
+	if !exists(filepath.Join(folder, "lib", "lib.txt")) {
+		t.Errorf("expected lib/lib.txt from the submodule, output: %v", output)
+	}
+	if !strings.Contains(output, "Sync submodule test_dir/lib at commit 0123abc") {
+		t.Errorf("main() got console output = \"%v\", want submodule sync", output)
+	}
+	log.SetOutput(nil)
+}
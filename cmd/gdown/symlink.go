@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+// symlinkHandlingInternal creates settings.OutFile as symbolic link, the target is the content of the
+// git blob. Targets which are absolute or point outside of settings.OutFolder are refused.
+func symlinkHandlingInternal(ctx context.Context, provider api.Provider, settings internal.Settings, logger *log.Logger) (fileResult, error) {
+	exists, dir := testTargetFolder(settings.OutFile)
+	if !exists {
+		if settings.DryRun && settings.OutFolder != "" {
+			return fileCreated, nil
+		}
+		return fileUnchanged, fmt.Errorf("Target folder %v doesn't exists", dir)
+	}
+
+	data, err := api.ReadFile(ctx, provider, settings)
+	if err != nil {
+		return fileUnchanged, fmt.Errorf("API Call error: %v", err)
+	}
+	if len(data) == 0 {
+		return fileUnchanged, fmt.Errorf("symlink target is empty")
+	}
+	// Cleaned, ".." can only be at the start, so the lexical check below matches what the OS resolves
+	target := filepath.Clean(filepath.FromSlash(string(data)))
+
+	if err := checkSymlinkTarget(settings.OutFolder, settings.OutFile, target); err != nil {
+		return fileUnchanged, err
+	}
+
+	if old, err := os.Readlink(settings.OutFile); err == nil && old == target {
+		return fileUnchanged, nil
+	}
+
+	result := fileUpdated
+	if _, err := os.Lstat(settings.OutFile); os.IsNotExist(err) {
+		result = fileCreated
+	}
+	if settings.DryRun {
+		return result, nil
+	}
+
+	// Create the link with a temporary name and rename it, like createAtomic and commit do for files
+	tmp := filepath.Join(dir, "."+filepath.Base(settings.OutFile)+".gdown-link")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return fileUnchanged, fmt.Errorf("Symlink: %v", err)
+	}
+	if err := os.Rename(tmp, settings.OutFile); err != nil {
+		os.Remove(tmp)
+		return fileUnchanged, fmt.Errorf("Rename: %v", err)
+	}
+	return result, nil
+}
+
+// checkSymlinkTarget returns an error if a link at linkPath to target would point outside of root
+func checkSymlinkTarget(root, linkPath, target string) error {
+	if filepath.IsAbs(target) || filepath.VolumeName(target) != "" || strings.HasPrefix(target, string(filepath.Separator)) {
+		return fmt.Errorf("symlink target %q must be a relative path", target)
+	}
+
+	resolved := filepath.Join(filepath.Dir(linkPath), target)
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink target %q points outside of %v", target, root)
+	}
+	return nil
+}
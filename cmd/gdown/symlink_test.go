@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+	"github.com/haevg-rz/git-file-downloader/internal/api"
+)
+
+func Test_checkSymlinkTarget(t *testing.T) {
+	root := filepath.FromSlash("/srv/conf")
+	link := filepath.Join(root, "sub", "link")
+
+	tests := []struct {
+		target  string
+		wantErr bool
+	}{
+		{target: "file", wantErr: false},
+		{target: filepath.FromSlash("../file"), wantErr: false},
+		{target: filepath.FromSlash("deep/er/file"), wantErr: false},
+		{target: filepath.FromSlash("../../file"), wantErr: true},
+		{target: "..", wantErr: false},
+		{target: filepath.FromSlash("../.."), wantErr: true},
+		{target: filepath.FromSlash("/etc/passwd"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			err := checkSymlinkTarget(root, link, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSymlinkTarget(%v) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_main_mode_folder_symlink_submodule(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on windows")
+	}
+
+	folder, err := getTempFolderPath()
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(folder)
+
+	setFlagsFolder(folder)
+
+	targets := map[string]string{
+		"test_dir%2Flink":      "file1.txt",
+		"test_dir%2Fsub%2Fup":  "../file1.txt",
+		"test_dir%2Fevil":      "../../etc/passwd",
+		"test_dir%2Ffile1.txt": "Test File 1\n",
+	}
+
+	api.HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+		if strings.Contains(url, `/repository/tree/?ref=master`) {
+			return []byte(`[
+				{"id": "a1", "name": "file1.txt", "type": "blob", "path": "test_dir/file1.txt", "mode": "100644"},
+				{"id": "a2", "name": "link", "type": "blob", "path": "test_dir/link", "mode": "120000"},
+				{"id": "a3", "name": "sub", "type": "tree", "path": "test_dir/sub", "mode": "040000"},
+				{"id": "a4", "name": "up", "type": "blob", "path": "test_dir/sub/up", "mode": "120000"},
+				{"id": "a5", "name": "evil", "type": "blob", "path": "test_dir/evil", "mode": "120000"},
+				{"id": "a6", "name": "lib", "type": "commit", "path": "test_dir/lib", "mode": "160000"}
+			]`), nil, nil
+		}
+		for path, content := range targets {
+			if strings.Contains(url, "repository/files/"+path+"?") {
+				return []byte(fmt.Sprintf(`{"file_name": "x", "content": "%v"}`, base64.StdEncoding.EncodeToString([]byte(content)))), nil, nil
+			}
+		}
+		if strings.Contains(url, `repository/branches`) {
+			return []byte(`[{"name": "master"}]`), nil, nil
+		}
+		return nil, nil, fmt.Errorf("Unknown TEST-URL %v", url)
+	}
+
+	output := captureOutput(func() {
+		mainSub()
+	})
+
+	for link, want := range map[string]string{"link": "file1.txt", "sub/up": "../file1.txt"} {
+		got, err := os.Readlink(filepath.Join(folder, filepath.FromSlash(link)))
+		if err != nil {
+			t.Errorf("Readlink(%v) error = %v, output: %v", link, err, output)
+			continue
+		}
+		if got != filepath.FromSlash(want) {
+			t.Errorf("Readlink(%v) = %v, want %v", link, got, want)
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(folder, "evil")); !os.IsNotExist(err) {
+		t.Errorf("expected no symlink pointing outside, got %v", err)
+	}
+	for _, want := range []string{"points outside of", "Skip: lib because it is a submodule"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("main() got console output = \"%v\", want \"%v\"", output, want)
+		}
+	}
+
+	// The second run doesn't touch the unchanged links
+	output = captureOutput(func() {
+		mainSub()
+	})
+	if strings.Contains(output, "Wrote symlink") {
+		t.Errorf("main() got console output = \"%v\", want no symlink written", output)
+	}
+	log.SetOutput(nil)
+}
@@ -1,87 +1,150 @@
 package api
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"path"
+	"regexp"
+	"strings"
 
 	"github.com/haevg-rz/git-file-downloader/internal"
 )
 
-var (
-	HttpGetFunc func(apiUrl string, settings internal.Settings) ([]byte, error) = httpGetInternal
-)
-
-func httpGetInternal(apiUrl string, settings internal.Settings) ([]byte, error) {
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// perPage is the page size requested from list endpoints, 100 is the maximum GitLab and GitHub allow
+const perPage = 100
+
+// getAllPages requests apiUrl and follows the pagination headers until all pages are collected
+func getAllPages[T any](ctx context.Context, c *Client, apiUrl string, settings internal.Settings) ([]T, error) {
+	var all []T
+	for apiUrl != "" {
+		body, header, err := c.get(ctx, apiUrl, settings)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []T
+		err = json.Unmarshal(body, &page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+
+		next, err := nextPageUrl(apiUrl, header)
+		if err != nil {
+			return nil, err
+		}
+		if next == apiUrl {
+			return nil, fmt.Errorf("pagination doesn't advance at %v", apiUrl)
+		}
+		// The token is sent to the next page too, so it must be on the host of the API
+		if next != "" && !sameOrigin(settings.ApiUrl, next) {
+			return nil, fmt.Errorf("next page %v is not on the host of %v", next, settings.ApiUrl)
+		}
+		apiUrl = next
 	}
+	return all, nil
+}
 
-	req, err := http.NewRequest("GET", apiUrl, nil)
-	if err != nil {
-		return nil, err
+// nextPageUrl returns the url of the next page or an empty string if apiUrl was the last page.
+// The Link header is used if present (offset and keyset pagination), otherwise X-Next-Page.
+func nextPageUrl(apiUrl string, header http.Header) (string, error) {
+	if next := linkNext(header.Get("Link")); next != "" {
+		return next, nil
 	}
-	req.Header.Add("Private-Token", settings.PrivateToken)
-	req.Header.Add("User-Agent", settings.UserAgent)
 
-	client := &http.Client{Transport: tr}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	nextPage := header.Get("X-Next-Page")
+	if nextPage == "" {
+		return "", nil
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP GET failed with status code %v", resp.StatusCode)
+	u, err := url.Parse(apiUrl)
+	if err != nil {
+		return "", err
 	}
+	query := u.Query()
+	query.Set("page", nextPage)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// sameOrigin returns whether rawUrl has the scheme and host of apiUrl
+func sameOrigin(apiUrl, rawUrl string) bool {
+	a, err := url.Parse(apiUrl)
 	if err != nil {
-		return nil, err
+		return false
 	}
-	err = resp.Body.Close()
+	b, err := url.Parse(rawUrl)
 	if err != nil {
-		return nil, err
+		return false
 	}
-	return body, nil
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
 }
 
-func GetBranches(settings internal.Settings) ([]GitLabBranch, error) {
-	apiUrl := fmt.Sprintf("%vprojects/%v/repository/branches", settings.ApiUrl, settings.ProjectNumber)
-	body, err := HttpGetFunc(apiUrl, settings)
-	if err != nil {
-		return nil, err
+// linkNext returns the target of rel="next" from a RFC 8288 Link header
+func linkNext(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		target, params, found := strings.Cut(part, ";")
+		if !found {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
 	}
+	return ""
+}
 
-	var responseStruct []GitLabBranch
-	err = json.Unmarshal(body, &responseStruct)
+// Kinds of a ref returned by ResolveRef
+const (
+	RefBranch = "branch"
+	RefTag    = "tag"
+	RefCommit = "commit"
+)
 
-	return responseStruct, err
+// commitPattern matches refs which may be a commit SHA, abbreviated or full SHA-1 or SHA-256
+var commitPattern = regexp.MustCompile(`^[0-9a-fA-F]{4,64}$`)
+
+// ErrRefNotFound is returned by ResolveRef if the ref is no branch, tag or commit of the project
+var ErrRefNotFound = errors.New("ref not found")
+
+// resolveRef returns the kind of the first url of refUrls which exists, only 404 responses are skipped
+func resolveRef(ctx context.Context, c *Client, settings internal.Settings, refUrls []refUrl) (string, error) {
+	for _, ref := range refUrls {
+		_, _, err := c.get(ctx, ref.url, settings)
+		if err == nil {
+			return ref.kind, nil
+		}
+		var httpErr *HttpError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%w: %v is no branch, tag or commit", ErrRefNotFound, settings.Ref)
 }
 
-type GitLabBranch struct {
-	Name string `json:"name"`
+type refUrl struct {
+	kind string
+	url  string
 }
 
-func GetFilesFromFolder(settings internal.Settings) ([]GitLabRepoFile, error) {
-	path := url.QueryEscape(settings.RepoFolderPath)
-	branch := url.QueryEscape(settings.Branch)
-	apiUrl := fmt.Sprintf("%vprojects/%v/repository/tree/?ref=%v&path=%v", settings.ApiUrl, settings.ProjectNumber, branch, path)
-
-	body, err := HttpGetFunc(apiUrl, settings)
-	if err != nil {
-		return nil, err
-	}
-
-	var responseStruct []GitLabRepoFile
-	err = json.Unmarshal(body, &responseStruct)
+// Project is a project or repository, ID is what the provider expects as settings.ProjectNumber
+type Project struct {
+	ID                string
+	PathWithNamespace string
+}
 
-	return responseStruct, err
+type Branch struct {
+	Name string `json:"name"`
 }
 
-type GitLabRepoFile struct {
+// RepoFile is an entry of the tree, Type is blob, tree or commit (submodule) and ID the git object ID
+type RepoFile struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 	Type string `json:"type"`
@@ -89,31 +152,86 @@ type GitLabRepoFile struct {
 	Mode string `json:"mode"`
 }
 
-func GetFile(settings internal.Settings) (GitLapFile, error) {
-	path := url.QueryEscape(settings.RepoFilePath)
-	branch := url.QueryEscape(settings.Branch)
-	apiUrl := fmt.Sprintf("%vprojects/%v/repository/files/%v?ref=%v", settings.ApiUrl, settings.ProjectNumber, path, branch)
+// FileMetadata are the hashes of a file, a provider may only know one of them
+type FileMetadata struct {
+	ContentSha256 string
+	// BlobID is the git object ID, the SHA-1 of the content with a blob header
+	BlobID string
+}
 
-	body, err := HttpGetFunc(apiUrl, settings)
-	if err != nil {
-		return GitLapFile{}, err
+// Matches returns whether m and other are the hashes of the same content. The SHA-256 is compared if
+// both have it, otherwise the blob ID.
+func (m FileMetadata) Matches(other FileMetadata) bool {
+	if m.ContentSha256 != "" && other.ContentSha256 != "" {
+		return m.ContentSha256 == other.ContentSha256
 	}
+	return m.BlobID != "" && m.BlobID == other.BlobID
+}
 
-	file, err := createGitLapFile(body)
-	if err != nil {
-		return GitLapFile{}, err
+// repository is the part of a repository of GitHub and Gitea which is needed
+type repository struct {
+	FullName string `json:"full_name"`
+}
+
+// gitTree is a recursive tree of GitHub and Gitea, truncated if not all entries are in the response
+type gitTree struct {
+	Tree      []gitTreeEntry `json:"tree"`
+	Truncated bool           `json:"truncated"`
+}
+
+// gitTreeEntry is an entry of a recursive tree, like git ls-tree -r -t lists it
+type gitTreeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Sha  string `json:"sha"`
+}
+
+// folderFiles returns the entries of the tree of the whole repository below settings.RepoFolderPath. A
+// missing folder is an error like the 404 of GitLab, not an empty folder.
+func folderFiles(entries []gitTreeEntry, settings internal.Settings) ([]RepoFile, error) {
+	folder := strings.Trim(settings.RepoFolderPath, "/")
+	prefix := ""
+	if folder != "" && folder != "." {
+		prefix = folder + "/"
+	}
+	folderFound := prefix == ""
+	var files []RepoFile
+	for _, entry := range entries {
+		if entry.Path == folder && entry.Type == "tree" {
+			folderFound = true
+		}
+		if !strings.HasPrefix(entry.Path, prefix) {
+			continue
+		}
+		files = append(files, RepoFile{ID: entry.Sha, Name: path.Base(entry.Path), Type: entry.Type, Path: entry.Path, Mode: entry.Mode})
+	}
+	if !folderFound {
+		return nil, fmt.Errorf("folder %v not found at %v", settings.RepoFolderPath, settings.Ref)
 	}
-	return file, nil
+	return files, nil
 }
 
-func createGitLapFile(data []byte) (GitLapFile, error) {
-	var gitLapFile GitLapFile
-	err := json.Unmarshal(data, &gitLapFile)
-	return gitLapFile, err
+// contentsMetadata returns the blob ID from the response of a contents API like GitHub and Gitea have it
+func contentsMetadata(body []byte, settings internal.Settings) (FileMetadata, error) {
+	var content struct {
+		Type string `json:"type"`
+		Sha  string `json:"sha"`
+	}
+	if err := json.Unmarshal(body, &content); err != nil {
+		return FileMetadata{}, err
+	}
+	if content.Type != "file" || content.Sha == "" {
+		return FileMetadata{}, fmt.Errorf("%v is a %v, not a file", settings.RepoFilePath, content.Type)
+	}
+	return FileMetadata{BlobID: content.Sha}, nil
 }
 
-type GitLapFile struct {
-	FileName      string `json:"file_name"`
-	ContentSha256 string `json:"content_sha256"`
-	Content       string
+// escapePath URL-encodes every part of a repository path like dir/file, the slashes are kept
+func escapePath(p string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
 }
@@ -1,7 +1,12 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -12,11 +17,11 @@ import (
 func TestGetBranches(t *testing.T) {
 	mockResponse := `[{"name": "master"}, {"name": "develop"}]`
 
-	HttpGetFunc = func(url string, s internal.Settings) ([]byte, error) {
+	HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
 		if strings.Contains(url, "/repository/branches") {
-			return []byte(mockResponse), nil
+			return []byte(mockResponse), nil, nil
 		}
-		return nil, errors.New("Unknown TESTING URL")
+		return nil, nil, errors.New("Unknown TESTING URL")
 	}
 
 	settings := internal.Settings{
@@ -26,7 +31,7 @@ func TestGetBranches(t *testing.T) {
 		UserAgent:     "test-agent",
 	}
 
-	branches, err := GetBranches(settings)
+	branches, err := testGitLab(t, settings).GetBranches(context.Background(), settings)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -40,14 +45,14 @@ func TestGetBranches(t *testing.T) {
 	}
 }
 
-func TestGetFilesFromFolder(t *testing.T) {
+func TestGetFilesFromFolderRecursive(t *testing.T) {
 	mockResponse := `[{"id": "1", "name": "file1.txt", "type": "blob", "path": "path/to/file1.txt", "mode": "100644"}]`
 
-	HttpGetFunc = func(url string, s internal.Settings) ([]byte, error) {
-		if strings.Contains(url, "/repository/tree") {
-			return []byte(mockResponse), nil
+	HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
+		if strings.Contains(url, "/repository/tree") && strings.Contains(url, "recursive=true") {
+			return []byte(mockResponse), nil, nil
 		}
-		return nil, errors.New("Unknown TESTING URL")
+		return nil, nil, errors.New("Unknown TESTING URL")
 	}
 
 	settings := internal.Settings{
@@ -56,10 +61,10 @@ func TestGetFilesFromFolder(t *testing.T) {
 		PrivateToken:   "test-token",
 		UserAgent:      "test-agent",
 		RepoFolderPath: "path/to",
-		Branch:         "master",
+		Ref:            "master",
 	}
 
-	files, err := GetFilesFromFolder(settings)
+	files, err := testGitLab(t, settings).GetFilesFromFolderRecursive(context.Background(), settings)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -80,11 +85,11 @@ func TestGetFile(t *testing.T) {
 		"content": "dGVzdCBjb250ZW50"
 	}`
 
-	HttpGetFunc = func(url string, s internal.Settings) ([]byte, error) {
+	HttpGetFunc = func(ctx context.Context, c *http.Client, url string, s internal.Settings) ([]byte, http.Header, error) {
 		if strings.Contains(url, "/repository/files") {
-			return []byte(mockResponse), nil
+			return []byte(mockResponse), nil, nil
 		}
-		return nil, errors.New("Unknown TESTING URL")
+		return nil, nil, errors.New("Unknown TESTING URL")
 	}
 
 	settings := internal.Settings{
@@ -93,10 +98,10 @@ func TestGetFile(t *testing.T) {
 		PrivateToken:  "test-token",
 		UserAgent:     "test-agent",
 		RepoFilePath:  "path/to/file1.txt",
-		Branch:        "master",
+		Ref:           "master",
 	}
 
-	file, err := GetFile(settings)
+	file, err := testGitLab(t, settings).GetFile(context.Background(), settings)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -115,3 +120,296 @@ func TestGetFile(t *testing.T) {
 		t.Errorf("expected content '%s', got '%s'", expectedContent, decodedContent)
 	}
 }
+
+func TestResolveRef(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.RequestURI)
+		switch r.RequestURI {
+		case "/api/v4/projects/1/repository/branches/main",
+			"/api/v4/projects/1/repository/tags/v1.0.0",
+			"/api/v4/projects/1/repository/commits/726a84679597812d8085085f742fb5ddba8a0299":
+			w.Write([]byte(`{}`))
+		case "/api/v4/projects/1/repository/branches/broken":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	HttpGetFunc = httpGetInternal
+
+	tests := []struct {
+		ref          string
+		want         string
+		wantErr      error
+		wantRequests int
+	}{
+		{ref: "main", want: RefBranch, wantRequests: 1},
+		{ref: "v1.0.0", want: RefTag, wantRequests: 2},
+		{ref: "726a84679597812d8085085f742fb5ddba8a0299", want: RefCommit, wantRequests: 3},
+		{ref: "missing", wantErr: ErrRefNotFound, wantRequests: 3},
+		{ref: "broken", wantErr: &HttpError{}, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			requests = nil
+			settings := internal.Settings{ApiUrl: server.URL + "/api/v4/", ProjectNumber: "1", Ref: tt.ref}
+
+			got, err := testGitLab(t, settings).ResolveRef(context.Background(), settings)
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("ResolveRef() error = %v", err)
+				}
+			case *HttpError:
+				if !errors.As(err, &want) || want.StatusCode != http.StatusForbidden {
+					t.Fatalf("ResolveRef() error = %v, want HTTP 403", err)
+				}
+			default:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveRef() error = %v, want %v", err, tt.wantErr)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRef() = %v, want %v", got, tt.want)
+			}
+			if len(requests) != tt.wantRequests {
+				t.Errorf("ResolveRef() requests = %v, want %v requests", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestGetFile_ProjectPath(t *testing.T) {
+	var requestURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+		w.Write([]byte(`{"file_name": "wg0.conf"}`))
+	}))
+	defer server.Close()
+	HttpGetFunc = httpGetInternal
+
+	settings := internal.Settings{
+		ApiUrl:        server.URL + "/api/v4/",
+		ProjectNumber: "infra/servers/wireguard",
+		RepoFilePath:  "conf/wg0.conf",
+		Ref:           "main",
+	}
+
+	if _, err := testGitLab(t, settings).GetFile(context.Background(), settings); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := "/api/v4/projects/infra%2Fservers%2Fwireguard/repository/files/conf%2Fwg0.conf?ref=main"
+	if requestURI != want {
+		t.Errorf("request uri = %v, want %v", requestURI, want)
+	}
+}
+
+func TestGetFileRaw(t *testing.T) {
+	var requestURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+		w.Write([]byte("raw content"))
+	}))
+	defer server.Close()
+	HttpStreamFunc = httpStreamInternal
+
+	settings := internal.Settings{
+		ApiUrl:        server.URL + "/api/v4/",
+		ProjectNumber: "1",
+		RepoFilePath:  "conf/big file.bin",
+		Ref:           "main",
+	}
+
+	body, err := testGitLab(t, settings).GetFileRaw(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "raw content" {
+		t.Errorf("content = %q, want %q", data, "raw content")
+	}
+	want := "/api/v4/projects/1/repository/files/conf%2Fbig%20file.bin/raw?ref=main"
+	if requestURI != want {
+		t.Errorf("request uri = %v, want %v", requestURI, want)
+	}
+}
+
+func TestGetFileMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method = %v, want HEAD", r.Method)
+		}
+		if r.URL.Query().Get("ref") == "main" {
+			w.Header().Set("X-Gitlab-Content-Sha256", "4d5a3f2b")
+			w.Header().Set("X-Gitlab-Blob-Id", "1e85ff77")
+		}
+	}))
+	defer server.Close()
+	HttpHeadFunc = httpHeadInternal
+
+	settings := internal.Settings{ApiUrl: server.URL + "/api/v4/", ProjectNumber: "1", RepoFilePath: "file1.txt", Ref: "main"}
+	metadata, err := testGitLab(t, settings).GetFileMetadata(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if metadata.ContentSha256 != "4d5a3f2b" || metadata.BlobID != "1e85ff77" {
+		t.Errorf("metadata = %+v", metadata)
+	}
+
+	// A proxy could strip the headers
+	settings.Ref = "other"
+	if _, err := testGitLab(t, settings).GetFileMetadata(context.Background(), settings); err == nil {
+		t.Error("expected error without X-Gitlab-Content-Sha256, got nil")
+	}
+
+	// In folder mode the tree has the blob ID, so there is no request
+	HttpHeadFunc = func(ctx context.Context, c *http.Client, apiUrl string, s internal.Settings) (http.Header, error) {
+		t.Errorf("unexpected HEAD %v", apiUrl)
+		return nil, errors.New("unexpected request")
+	}
+	settings.RepoFileID = "1e85ff77"
+	if metadata, err := testGitLab(t, settings).GetFileMetadata(context.Background(), settings); err != nil || metadata != (FileMetadata{BlobID: "1e85ff77"}) {
+		t.Errorf("GetFileMetadata() with RepoFileID = %+v, %v", metadata, err)
+	}
+}
+
+func TestGetFilesFromFolderRecursive_Pagination(t *testing.T) {
+	pages := map[string]string{
+		"1": `[{"id": "1", "name": "file1.txt", "type": "blob", "path": "path/to/file1.txt", "mode": "100644"}]`,
+		"2": `[{"id": "2", "name": "file2.txt", "type": "blob", "path": "path/to/file2.txt", "mode": "100644"}]`,
+		"3": `[{"id": "3", "name": "file3.txt", "type": "blob", "path": "path/to/file3.txt", "mode": "100644"}]`,
+	}
+
+	var requested []string
+	HttpGetFunc = func(ctx context.Context, c *http.Client, apiUrl string, s internal.Settings) ([]byte, http.Header, error) {
+		if !strings.Contains(apiUrl, "/repository/tree") {
+			return nil, nil, errors.New("Unknown TESTING URL")
+		}
+		requested = append(requested, apiUrl)
+
+		header := http.Header{}
+		switch {
+		case strings.Contains(apiUrl, "page_token=3"):
+			return []byte(pages["3"]), header, nil
+		case strings.Contains(apiUrl, "page=2"):
+			// keyset pagination only announces the next page with a Link header
+			header.Set("Link", `<https://gitlab.com/api/v4/projects/123456/repository/tree?page_token=3>; rel="next", <https://gitlab.com/api/v4/projects/123456/repository/tree?page=1>; rel="first"`)
+			return []byte(pages["2"]), header, nil
+		default:
+			header.Set("X-Next-Page", "2")
+			return []byte(pages["1"]), header, nil
+		}
+	}
+
+	settings := internal.Settings{
+		ApiUrl:         "https://gitlab.com/api/v4/",
+		ProjectNumber:  "123456",
+		RepoFolderPath: "path/to",
+		Ref:            "master",
+	}
+
+	files, err := testGitLab(t, settings).GetFilesFromFolderRecursive(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %d", len(files))
+	}
+	for i, file := range files {
+		want := fmt.Sprintf("file%d.txt", i+1)
+		if file.Name != want {
+			t.Errorf("expected file name '%s', got %s", want, file.Name)
+		}
+	}
+	if len(requested) != 3 {
+		t.Errorf("expected 3 requests, got %d: %v", len(requested), requested)
+	}
+}
+
+func TestGetFilesFromFolderRecursive_PaginationNotAdvancing(t *testing.T) {
+	HttpGetFunc = func(ctx context.Context, c *http.Client, apiUrl string, s internal.Settings) ([]byte, http.Header, error) {
+		header := http.Header{}
+		header.Set("Link", fmt.Sprintf(`<%v>; rel="next"`, apiUrl))
+		return []byte(`[]`), header, nil
+	}
+
+	settings := internal.Settings{
+		ApiUrl:         "https://gitlab.com/api/v4/",
+		ProjectNumber:  "123456",
+		RepoFolderPath: "path/to",
+		Ref:            "master",
+	}
+
+	_, err := testGitLab(t, settings).GetFilesFromFolderRecursive(context.Background(), settings)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestGetFilesFromFolderRecursive_PaginationOtherHost(t *testing.T) {
+	var requested []string
+	HttpGetFunc = func(ctx context.Context, c *http.Client, apiUrl string, s internal.Settings) ([]byte, http.Header, error) {
+		requested = append(requested, apiUrl)
+		header := http.Header{}
+		header.Set("Link", `<https://attacker.example.com/api/v4/projects/123456/repository/tree?page=2>; rel="next"`)
+		return []byte(`[]`), header, nil
+	}
+
+	settings := internal.Settings{
+		ApiUrl:         "https://gitlab.com/api/v4/",
+		ProjectNumber:  "123456",
+		PrivateToken:   "test-token",
+		RepoFolderPath: "path/to",
+		Ref:            "master",
+	}
+
+	if _, err := testGitLab(t, settings).GetFilesFromFolderRecursive(context.Background(), settings); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if len(requested) != 1 {
+		t.Errorf("expected only the first request, got %v", requested)
+	}
+}
+
+func Test_linkNext(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{name: "Empty", link: "", want: ""},
+		{name: "Only first", link: `<https://a/?page=1>; rel="first"`, want: ""},
+		{name: "Next and last", link: `<https://a/?page=2>; rel="next", <https://a/?page=5>; rel="last"`, want: "https://a/?page=2"},
+		{name: "Next not first", link: `<https://a/?page=1>; rel="prev", <https://a/?page=3>; rel="next"`, want: "https://a/?page=3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := linkNext(tt.link); got != tt.want {
+				t.Errorf("linkNext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testClient(t *testing.T, settings internal.Settings) *Client {
+	client, err := NewClient(settings)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func testGitLab(t *testing.T, settings internal.Settings) *GitLab {
+	return &GitLab{Client: testClient(t, settings)}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// setAuth adds the token to req as settings.AuthType requires, without it as the provider expects
+func setAuth(req *http.Request, settings internal.Settings) {
+	authType := settings.AuthType
+	if authType == "" && !settings.IsGitLab() {
+		authType = internal.AuthBearer
+		if settings.Provider == internal.ProviderAzure {
+			// A personal access token of Azure DevOps is sent as basic auth, the username is ignored
+			authType = internal.AuthDeployToken
+		}
+	}
+	switch authType {
+	case internal.AuthJobToken:
+		req.Header.Set("JOB-TOKEN", settings.PrivateToken)
+	case internal.AuthDeployToken:
+		req.SetBasicAuth(settings.Username, settings.PrivateToken)
+	case internal.AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+settings.PrivateToken)
+	default:
+		req.Header.Set("Private-Token", settings.PrivateToken)
+	}
+}
+
+// setGitAuth adds the token to req like git sends it to the git HTTP endpoints of a host, which includes
+// Git LFS. That's basic auth with the token as password, the job token of GitLab CI has a fixed username.
+// Bitbucket takes its tokens as bearer like its API.
+func setGitAuth(req *http.Request, settings internal.Settings) {
+	switch {
+	case settings.AuthType == internal.AuthJobToken:
+		req.SetBasicAuth("gitlab-ci-token", settings.PrivateToken)
+	case settings.AuthType == internal.AuthBearer, settings.AuthType == "" && settings.Provider == internal.ProviderBitbucket:
+		req.Header.Set("Authorization", "Bearer "+settings.PrivateToken)
+	default:
+		username := settings.Username
+		if username == "" {
+			// Any username is taken with a token, GitLab needs oauth2 for OAuth2 tokens
+			username = "oauth2"
+		}
+		req.SetBasicAuth(username, settings.PrivateToken)
+	}
+}
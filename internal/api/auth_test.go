@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+func Test_setAuth(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		settings   internal.Settings
+		wantHeader string
+		wantValue  string
+	}{
+		{name: "Default", settings: internal.Settings{PrivateToken: "token"}, wantHeader: "Private-Token", wantValue: "token"},
+		{name: "Private token", settings: internal.Settings{PrivateToken: "token", AuthType: internal.AuthPrivateToken}, wantHeader: "Private-Token", wantValue: "token"},
+		{name: "Job token", settings: internal.Settings{PrivateToken: "token", AuthType: internal.AuthJobToken}, wantHeader: "Job-Token", wantValue: "token"},
+		// "gdown:token" base64 encoded
+		{name: "Deploy token", settings: internal.Settings{PrivateToken: "token", AuthType: internal.AuthDeployToken, Username: "gdown"}, wantHeader: "Authorization", wantValue: "Basic Z2Rvd246dG9rZW4="},
+		{name: "Bearer", settings: internal.Settings{PrivateToken: "token", AuthType: internal.AuthBearer}, wantHeader: "Authorization", wantValue: "Bearer token"},
+		// ":token" base64 encoded
+		{name: "Azure DevOps default", settings: internal.Settings{PrivateToken: "token", Provider: internal.ProviderAzure}, wantHeader: "Authorization", wantValue: "Basic OnRva2Vu"},
+		{name: "GitHub default", settings: internal.Settings{PrivateToken: "token", Provider: internal.ProviderGitHub}, wantHeader: "Authorization", wantValue: "Bearer token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testClient(t, tt.settings)
+			if _, _, err := httpGetInternal(context.Background(), client.httpClient, server.URL, tt.settings); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Get(tt.wantHeader) != tt.wantValue {
+				t.Errorf("header %v = %q, want %q", tt.wantHeader, got.Get(tt.wantHeader), tt.wantValue)
+			}
+			for _, header := range []string{"Private-Token", "Job-Token", "Authorization"} {
+				if header != tt.wantHeader && got.Get(header) != "" {
+					t.Errorf("header %v = %q, want only %v", header, got.Get(header), tt.wantHeader)
+				}
+			}
+		})
+	}
+}
+
+func Test_setGitAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings internal.Settings
+		want     string
+	}{
+		// "oauth2:token" base64 encoded
+		{name: "Default", settings: internal.Settings{PrivateToken: "token"}, want: "Basic b2F1dGgyOnRva2Vu"},
+		// "gitlab-ci-token:token" base64 encoded
+		{name: "Job token", settings: internal.Settings{PrivateToken: "token", AuthType: internal.AuthJobToken}, want: "Basic Z2l0bGFiLWNpLXRva2VuOnRva2Vu"},
+		// "gdown:token" base64 encoded
+		{name: "Deploy token", settings: internal.Settings{PrivateToken: "token", AuthType: internal.AuthDeployToken, Username: "gdown"}, want: "Basic Z2Rvd246dG9rZW4="},
+		{name: "Bearer", settings: internal.Settings{PrivateToken: "token", AuthType: internal.AuthBearer}, want: "Bearer token"},
+		{name: "Bitbucket default", settings: internal.Settings{PrivateToken: "token", Provider: internal.ProviderBitbucket}, want: "Bearer token"},
+		{name: "GitHub default", settings: internal.Settings{PrivateToken: "token", Provider: internal.ProviderGitHub}, want: "Basic b2F1dGgyOnRva2Vu"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{Header: http.Header{}}
+			setGitAuth(req, tt.settings)
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
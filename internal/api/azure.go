@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// azureApiVersion is the version of the Azure DevOps REST API, supported by Azure DevOps Server 2020 too
+const azureApiVersion = "api-version=6.0"
+
+// Azure is the Provider for the Git Items API of Azure DevOps Services and Server
+// (https://dev.azure.com/org/). The project is the project and the repository like infra/wireguard.
+type Azure struct {
+	*Client
+
+	// versionTypes caches the kind of the refs resolved by ResolveRef by versionKey, every items request
+	// needs it
+	mu           sync.Mutex
+	versionTypes map[string]string
+}
+
+func (a *Azure) repoUrl(settings internal.Settings) string {
+	project, repo, _ := strings.Cut(settings.RepoPathEscaped(), "/")
+	return fmt.Sprintf("%v%v/_apis/git/repositories/%v", settings.ApiUrl, project, repo)
+}
+
+func (a *Azure) GetBranches(ctx context.Context, settings internal.Settings) ([]Branch, error) {
+	refs, err := a.refs(ctx, settings, "heads/")
+	if err != nil {
+		return nil, err
+	}
+	var branches []Branch
+	for _, ref := range refs {
+		branches = append(branches, Branch{Name: strings.TrimPrefix(ref.Name, "refs/heads/")})
+	}
+	return branches, nil
+}
+
+// ResolveRef returns whether settings.Ref is a branch, tag or commit. The refs API filters by prefix, so
+// the exact name is searched in the result.
+func (a *Azure) ResolveRef(ctx context.Context, settings internal.Settings) (string, error) {
+	kind, err := a.resolveRef(ctx, settings)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.versionTypes == nil {
+		a.versionTypes = make(map[string]string)
+	}
+	a.versionTypes[a.versionKey(settings)] = kind
+	return kind, nil
+}
+
+// versionKey is the key of settings.Ref in versionTypes, the same ref can be a branch in one repository
+// and a tag in another
+func (a *Azure) versionKey(settings internal.Settings) string {
+	return a.repoUrl(settings) + " " + settings.Ref
+}
+
+func (a *Azure) resolveRef(ctx context.Context, settings internal.Settings) (string, error) {
+	for _, prefix := range []struct{ kind, filter string }{{RefBranch, "heads/"}, {RefTag, "tags/"}} {
+		refs, err := a.refs(ctx, settings, prefix.filter+settings.Ref)
+		if err != nil {
+			return "", err
+		}
+		for _, ref := range refs {
+			if ref.Name == "refs/"+prefix.filter+settings.Ref {
+				return prefix.kind, nil
+			}
+		}
+	}
+
+	// Azure DevOps answers a ref which is no commit SHA with 400 instead of 404
+	if !commitPattern.MatchString(settings.Ref) {
+		return "", fmt.Errorf("%w: %v is no branch, tag or commit", ErrRefNotFound, settings.Ref)
+	}
+	return resolveRef(ctx, a.Client, settings, []refUrl{
+		{kind: RefCommit, url: fmt.Sprintf("%v/commits/%v?%v", a.repoUrl(settings), url.PathEscape(settings.Ref), azureApiVersion)},
+	})
+}
+
+// refs lists the refs starting with refs/filter
+func (a *Azure) refs(ctx context.Context, settings internal.Settings, filter string) ([]azureRef, error) {
+	apiUrl := fmt.Sprintf("%v/refs?filter=%v&$top=%v&%v", a.repoUrl(settings), url.QueryEscape(filter), perPage, azureApiVersion)
+	return getAzurePages[azureRef](ctx, a.Client, apiUrl, settings)
+}
+
+type azureRef struct {
+	Name string `json:"name"`
+}
+
+// versionDescriptor returns the query parameters which select settings.Ref for the items API, the ref is
+// resolved if ResolveRef didn't do it before
+func (a *Azure) versionDescriptor(ctx context.Context, settings internal.Settings) (string, error) {
+	a.mu.Lock()
+	kind, ok := a.versionTypes[a.versionKey(settings)]
+	a.mu.Unlock()
+	if !ok {
+		var err error
+		if kind, err = a.ResolveRef(ctx, settings); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("versionDescriptor.version=%v&versionDescriptor.versionType=%v", url.QueryEscape(settings.Ref), kind), nil
+}
+
+// GetProject returns the repository settings.ProjectNumber, the ID is project/repo
+func (a *Azure) GetProject(ctx context.Context, settings internal.Settings) (Project, error) {
+	body, _, err := a.get(ctx, a.repoUrl(settings)+"?"+azureApiVersion, settings)
+	if err != nil {
+		return Project{}, err
+	}
+
+	var repo struct {
+		Name    string `json:"name"`
+		Project struct {
+			Name string `json:"name"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &repo); err != nil {
+		return Project{}, err
+	}
+	id := repo.Project.Name + "/" + repo.Name
+	return Project{ID: id, PathWithNamespace: id}, nil
+}
+
+// GetFilesFromFolderRecursive lists all files and folders below settings.RepoFolderPath with a single items
+// request. Azure DevOps has no git modes, the mode of files is empty, so their local permissions are kept.
+func (a *Azure) GetFilesFromFolderRecursive(ctx context.Context, settings internal.Settings) ([]RepoFile, error) {
+	version, err := a.versionDescriptor(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := strings.Trim(settings.RepoFolderPath, "/")
+	apiUrl := fmt.Sprintf("%v/items?scopePath=%v&recursionLevel=Full&%v&%v", a.repoUrl(settings), url.QueryEscape("/"+folder), version, azureApiVersion)
+	items, err := getAzurePages[azureItem](ctx, a.Client, apiUrl, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []gitTreeEntry
+	for _, item := range items {
+		entryPath := strings.Trim(item.Path, "/")
+		if entryPath == "" {
+			continue
+		}
+		entry := gitTreeEntry{Path: entryPath, Type: item.GitObjectType, Sha: item.ObjectID}
+		switch item.GitObjectType {
+		case "tree":
+			entry.Mode = "040000"
+		case "commit":
+			entry.Mode = "160000"
+		}
+		entries = append(entries, entry)
+	}
+	return folderFiles(entries, settings)
+}
+
+type azureItem struct {
+	ObjectID string `json:"objectId"`
+	// GitObjectType is blob, tree or commit
+	GitObjectType string `json:"gitObjectType"`
+	Path          string `json:"path"`
+}
+
+// GetFileMetadata returns the blob ID of settings.RepoFilePath, Azure DevOps has no SHA-256 of the
+// content. In folder mode the blob ID is known from the items, otherwise the item is requested.
+func (a *Azure) GetFileMetadata(ctx context.Context, settings internal.Settings) (FileMetadata, error) {
+	if settings.RepoFileID != "" {
+		return FileMetadata{BlobID: settings.RepoFileID}, nil
+	}
+
+	apiUrl, err := a.itemUrl(ctx, settings)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	body, _, err := a.get(withAccept(ctx, "application/json"), apiUrl, settings)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+
+	var item azureItem
+	if err := json.Unmarshal(body, &item); err != nil {
+		return FileMetadata{}, err
+	}
+	if item.GitObjectType != "blob" || item.ObjectID == "" {
+		return FileMetadata{}, fmt.Errorf("%v is a %v, not a file", settings.RepoFilePath, item.GitObjectType)
+	}
+	return FileMetadata{BlobID: item.ObjectID}, nil
+}
+
+// GetFileRaw opens the content of settings.RepoFilePath from the items API. The caller must close it.
+func (a *Azure) GetFileRaw(ctx context.Context, settings internal.Settings) (io.ReadCloser, error) {
+	apiUrl, err := a.itemUrl(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := a.stream(withAccept(ctx, "application/octet-stream"), apiUrl+"&$format=octetStream", settings)
+	return body, err
+}
+
+func (a *Azure) itemUrl(ctx context.Context, settings internal.Settings) (string, error) {
+	version, err := a.versionDescriptor(ctx, settings)
+	if err != nil {
+		return "", err
+	}
+	filePath := "/" + strings.Trim(settings.RepoFilePath, "/")
+	return fmt.Sprintf("%v/items?path=%v&%v&%v", a.repoUrl(settings), url.QueryEscape(filePath), version, azureApiVersion), nil
+}
+
+// getAzurePages requests apiUrl and the following pages while the response has a continuation token
+func getAzurePages[T any](ctx context.Context, c *Client, apiUrl string, settings internal.Settings) ([]T, error) {
+	var all []T
+	pageUrl := apiUrl
+	for {
+		body, header, err := c.get(ctx, pageUrl, settings)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Value []T `json:"value"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Value...)
+
+		token := header.Get("x-ms-continuationtoken")
+		if token == "" {
+			return all, nil
+		}
+		nextUrl := apiUrl + "&continuationToken=" + url.QueryEscape(token)
+		if nextUrl == pageUrl {
+			return nil, fmt.Errorf("pagination doesn't advance at %v", pageUrl)
+		}
+		pageUrl = nextUrl
+	}
+}
+
+// GetLFSObject opens the content of pointer from the Git LFS API of the repository
+func (a *Azure) GetLFSObject(ctx context.Context, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error) {
+	return getLFSObject(ctx, a.Client, settings, pointer)
+}
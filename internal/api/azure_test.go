@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// azureServer serves a repository infra/wireguard with the branches main and feature/wg1 like the Azure
+// DevOps API, the refs have two pages
+func azureServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	json := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if user, password, _ := r.BasicAuth(); password != "token" {
+				t.Errorf("basic auth = %q, %q", user, password)
+			}
+			if r.URL.Query().Get("api-version") == "" {
+				t.Errorf("api-version is missing in %v", r.URL)
+			}
+			w.Write([]byte(body))
+		}
+	}
+	const repo = "/org/infra/_apis/git/repositories/wireguard"
+	version := func(r *http.Request) {
+		if got := r.URL.Query().Get("versionDescriptor.versionType"); got != "branch" {
+			t.Errorf("versionType = %q, want branch", got)
+		}
+	}
+
+	mux.HandleFunc("GET "+repo, json(`{"name": "wireguard", "project": {"name": "infra"}}`))
+	mux.HandleFunc("GET "+repo+"/refs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("filter") {
+		case "heads/":
+			if r.URL.Query().Get("continuationToken") == "" {
+				w.Header().Set("x-ms-continuationtoken", "page2")
+				json(`{"value": [{"name": "refs/heads/main"}], "count": 1}`)(w, r)
+				return
+			}
+			json(`{"value": [{"name": "refs/heads/feature/wg1"}], "count": 1}`)(w, r)
+		case "heads/main":
+			json(`{"value": [{"name": "refs/heads/main"}, {"name": "refs/heads/main-old"}], "count": 2}`)(w, r)
+		case "heads/feature/wg1":
+			json(`{"value": [{"name": "refs/heads/feature/wg1"}], "count": 1}`)(w, r)
+		case "tags/v1.0":
+			json(`{"value": [{"name": "refs/tags/v1.0"}], "count": 1}`)(w, r)
+		default:
+			json(`{"value": [], "count": 0}`)(w, r)
+		}
+	})
+	mux.HandleFunc("GET "+repo+"/commits/9fb037", json(`{"commitId": "9fb037"}`))
+	mux.HandleFunc("GET "+repo+"/items", func(w http.ResponseWriter, r *http.Request) {
+		version(r)
+		query := r.URL.Query()
+		switch {
+		case query.Get("scopePath") == "/conf" && query.Get("recursionLevel") == "Full":
+			json(`{"count": 5, "value": [
+				{"objectId": "b2", "gitObjectType": "tree", "path": "/conf", "isFolder": true},
+				{"objectId": "c3", "gitObjectType": "blob", "path": "/conf/wg0.conf"},
+				{"objectId": "f6", "gitObjectType": "tree", "path": "/conf/peers", "isFolder": true},
+				{"objectId": "d4", "gitObjectType": "blob", "path": "/conf/peers/laptop.conf"},
+				{"objectId": "e5", "gitObjectType": "commit", "path": "/conf/keys"}
+			]}`)(w, r)
+		case query.Get("path") == "/conf/wg0.conf" && query.Get("$format") == "octetStream":
+			json("[Interface]\n")(w, r)
+		case query.Get("path") == "/conf/wg0.conf":
+			json(`{"objectId": "c3", "gitObjectType": "blob", "path": "/conf/wg0.conf"}`)(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	HttpGetFunc = httpGetInternal
+	HttpStreamFunc = httpStreamInternal
+	return server
+}
+
+func testAzure(t *testing.T, settings internal.Settings) *Azure {
+	return &Azure{Client: testClient(t, settings)}
+}
+
+func azureSettings(server *httptest.Server) internal.Settings {
+	return internal.Settings{Provider: internal.ProviderAzure, ApiUrl: server.URL + "/org/", ProjectNumber: "infra/wireguard", PrivateToken: "token", Ref: "main"}
+}
+
+func TestAzure_ResolveRef(t *testing.T) {
+	server := azureServer(t)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{ref: "main", want: RefBranch},
+		{ref: "feature/wg1", want: RefBranch},
+		{ref: "v1.0", want: RefTag},
+		{ref: "9fb037", want: RefCommit},
+		{ref: "abcdef", wantErr: ErrRefNotFound},
+		{ref: "missing", wantErr: ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			settings := azureSettings(server)
+			settings.Ref = tt.ref
+			got, err := testAzure(t, settings).ResolveRef(context.Background(), settings)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveRef() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveRef() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAzure_versionDescriptor_PerRepository(t *testing.T) {
+	// main is a branch of wireguard and a tag of other
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path + " " + r.URL.Query().Get("filter") {
+		case "/org/infra/_apis/git/repositories/wireguard/refs heads/main":
+			w.Write([]byte(`{"value": [{"name": "refs/heads/main"}], "count": 1}`))
+		case "/org/infra/_apis/git/repositories/other/refs tags/main":
+			w.Write([]byte(`{"value": [{"name": "refs/tags/main"}], "count": 1}`))
+		default:
+			w.Write([]byte(`{"value": [], "count": 0}`))
+		}
+	}))
+	defer server.Close()
+	HttpGetFunc = httpGetInternal
+
+	settings := azureSettings(server)
+	azure := testAzure(t, settings)
+	if kind, err := azure.ResolveRef(context.Background(), settings); err != nil || kind != RefBranch {
+		t.Fatalf("ResolveRef() = %v, %v, want %v", kind, err, RefBranch)
+	}
+
+	settings.ProjectNumber = "infra/other"
+	got, err := azure.versionDescriptor(context.Background(), settings)
+	if want := "versionDescriptor.version=main&versionDescriptor.versionType=tag"; err != nil || got != want {
+		t.Errorf("versionDescriptor() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestAzure_GetBranches(t *testing.T) {
+	server := azureServer(t)
+	settings := azureSettings(server)
+
+	branches, err := testAzure(t, settings).GetBranches(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []Branch{{Name: "main"}, {Name: "feature/wg1"}}; !reflect.DeepEqual(branches, want) {
+		t.Errorf("branches = %+v, want %+v", branches, want)
+	}
+}
+
+func TestAzure_GetFilesFromFolderRecursive(t *testing.T) {
+	server := azureServer(t)
+	settings := azureSettings(server)
+	settings.RepoFolderPath = "conf"
+
+	files, err := testAzure(t, settings).GetFilesFromFolderRecursive(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []RepoFile{
+		{ID: "c3", Name: "wg0.conf", Type: "blob", Path: "conf/wg0.conf"},
+		{ID: "f6", Name: "peers", Type: "tree", Path: "conf/peers", Mode: "040000"},
+		{ID: "d4", Name: "laptop.conf", Type: "blob", Path: "conf/peers/laptop.conf"},
+		{ID: "e5", Name: "keys", Type: "commit", Path: "conf/keys", Mode: "160000"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %+v, want %+v", files, want)
+	}
+}
+
+func TestAzure_GetFile(t *testing.T) {
+	server := azureServer(t)
+	settings := azureSettings(server)
+	settings.RepoFilePath = "conf/wg0.conf"
+	azure := testAzure(t, settings)
+
+	metadata, err := azure.GetFileMetadata(context.Background(), settings)
+	if err != nil || metadata != (FileMetadata{BlobID: "c3"}) {
+		t.Errorf("GetFileMetadata() = %+v, %v", metadata, err)
+	}
+
+	body, err := azure.GetFileRaw(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("GetFileRaw() error = %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil || string(data) != "[Interface]\n" {
+		t.Errorf("GetFileRaw() = %q, %v", data, err)
+	}
+}
+
+func TestAzure_GetProject(t *testing.T) {
+	server := azureServer(t)
+	settings := azureSettings(server)
+
+	project, err := testAzure(t, settings).GetProject(context.Background(), settings)
+	if err != nil || project != (Project{ID: "infra/wireguard", PathWithNamespace: "infra/wireguard"}) {
+		t.Errorf("GetProject() = %+v, %v", project, err)
+	}
+}
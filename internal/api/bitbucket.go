@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// Bitbucket is the Provider for the REST API of Bitbucket Server and Data Center
+// (https://host/rest/api/latest/). The project is the project key and the repository slug like
+// INFRA/wireguard, or ~user/repo for the repository of a user.
+type Bitbucket struct {
+	*Client
+}
+
+func (b *Bitbucket) repoUrl(settings internal.Settings) string {
+	key, slug, _ := strings.Cut(settings.RepoPathEscaped(), "/")
+	return fmt.Sprintf("%vprojects/%v/repos/%v", settings.ApiUrl, key, slug)
+}
+
+func (b *Bitbucket) GetBranches(ctx context.Context, settings internal.Settings) ([]Branch, error) {
+	apiUrl := fmt.Sprintf("%v/branches?limit=%v", b.repoUrl(settings), perPage)
+	refs, err := getBitbucketPages[bitbucketRef](ctx, b.Client, apiUrl, settings)
+	if err != nil {
+		return nil, err
+	}
+	var branches []Branch
+	for _, ref := range refs {
+		branches = append(branches, Branch{Name: ref.DisplayID})
+	}
+	return branches, nil
+}
+
+// ResolveRef returns whether settings.Ref is a branch, tag or commit. Bitbucket has no endpoint for a
+// single branch, so the branches filtered by the ref are searched for it.
+func (b *Bitbucket) ResolveRef(ctx context.Context, settings internal.Settings) (string, error) {
+	apiUrl := fmt.Sprintf("%v/branches?filterText=%v&limit=%v", b.repoUrl(settings), url.QueryEscape(settings.Ref), perPage)
+	branches, err := getBitbucketPages[bitbucketRef](ctx, b.Client, apiUrl, settings)
+	if err != nil {
+		return "", err
+	}
+	for _, branch := range branches {
+		if branch.DisplayID == settings.Ref {
+			return RefBranch, nil
+		}
+	}
+
+	return resolveRef(ctx, b.Client, settings, []refUrl{
+		{kind: RefTag, url: fmt.Sprintf("%v/tags/%v", b.repoUrl(settings), escapePath(settings.Ref))},
+		{kind: RefCommit, url: fmt.Sprintf("%v/commits/%v", b.repoUrl(settings), url.PathEscape(settings.Ref))},
+	})
+}
+
+type bitbucketRef struct {
+	DisplayID string `json:"displayId"`
+}
+
+// GetProject returns the repository settings.ProjectNumber, the ID is KEY/slug
+func (b *Bitbucket) GetProject(ctx context.Context, settings internal.Settings) (Project, error) {
+	body, _, err := b.get(ctx, b.repoUrl(settings), settings)
+	if err != nil {
+		return Project{}, err
+	}
+
+	var repo struct {
+		Slug    string `json:"slug"`
+		Project struct {
+			Key string `json:"key"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &repo); err != nil {
+		return Project{}, err
+	}
+	id := repo.Project.Key + "/" + repo.Slug
+	return Project{ID: id, PathWithNamespace: id}, nil
+}
+
+// GetFilesFromFolderRecursive lists all files and folders below settings.RepoFolderPath with one browse
+// request per folder. Bitbucket has no git modes, the mode of files is empty, so their local permissions
+// are kept.
+func (b *Bitbucket) GetFilesFromFolderRecursive(ctx context.Context, settings internal.Settings) ([]RepoFile, error) {
+	return b.browse(ctx, settings, strings.Trim(settings.RepoFolderPath, "/"))
+}
+
+func (b *Bitbucket) browse(ctx context.Context, settings internal.Settings, folder string) ([]RepoFile, error) {
+	children, err := b.children(ctx, settings, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []RepoFile
+	for _, child := range children {
+		filePath := path.Join(folder, child.Path.ToString)
+		file := RepoFile{ID: child.ContentID, Name: path.Base(filePath), Type: "blob", Path: filePath}
+		switch child.Type {
+		case "DIRECTORY":
+			file.Type, file.Mode = "tree", "040000"
+			subFiles, err := b.browse(ctx, settings, filePath)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+			files = append(files, subFiles...)
+			continue
+		case "SUBMODULE":
+			file.Type, file.Mode = "commit", "160000"
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// children lists the direct children of folder
+func (b *Bitbucket) children(ctx context.Context, settings internal.Settings, folder string) ([]bitbucketChild, error) {
+	apiUrl := b.repoUrl(settings) + "/browse"
+	if folder != "" {
+		apiUrl += "/" + escapePath(folder)
+	}
+	apiUrl += fmt.Sprintf("?at=%v&limit=%v", url.QueryEscape(settings.Ref), perPage)
+	return getBitbucketPages[bitbucketChild](ctx, b.Client, apiUrl, settings)
+}
+
+type bitbucketChild struct {
+	Path struct {
+		ToString string `json:"toString"`
+	} `json:"path"`
+	// ContentID is the git object ID
+	ContentID string `json:"contentId"`
+	// Type is FILE, DIRECTORY or SUBMODULE
+	Type string `json:"type"`
+}
+
+// GetFileMetadata returns the blob ID of settings.RepoFilePath, Bitbucket has no SHA-256 of the content.
+// In folder mode the blob ID is known from browse, otherwise the folder of the file is browsed.
+func (b *Bitbucket) GetFileMetadata(ctx context.Context, settings internal.Settings) (FileMetadata, error) {
+	if settings.RepoFileID != "" {
+		return FileMetadata{BlobID: settings.RepoFileID}, nil
+	}
+
+	folder, name := path.Split(strings.Trim(settings.RepoFilePath, "/"))
+	children, err := b.children(ctx, settings, strings.TrimSuffix(folder, "/"))
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	for _, child := range children {
+		if child.Path.ToString == name && child.Type == "FILE" && child.ContentID != "" {
+			return FileMetadata{BlobID: child.ContentID}, nil
+		}
+	}
+	return FileMetadata{}, fmt.Errorf("%v not found at %v", settings.RepoFilePath, settings.Ref)
+}
+
+// GetFileRaw opens the content of settings.RepoFilePath from the raw endpoint. The caller must close it.
+func (b *Bitbucket) GetFileRaw(ctx context.Context, settings internal.Settings) (io.ReadCloser, error) {
+	apiUrl := fmt.Sprintf("%v/raw/%v?at=%v", b.repoUrl(settings), escapePath(settings.RepoFilePath), url.QueryEscape(settings.Ref))
+	body, _, err := b.stream(ctx, apiUrl, settings)
+	return body, err
+}
+
+// bitbucketPage is a page of a list, browse has it in children
+type bitbucketPage[T any] struct {
+	Values        []T  `json:"values"`
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+// getBitbucketPages requests apiUrl with increasing start until the last page is collected
+func getBitbucketPages[T any](ctx context.Context, c *Client, apiUrl string, settings internal.Settings) ([]T, error) {
+	var all []T
+	start := 0
+	for {
+		pageUrl := fmt.Sprintf("%v&start=%v", apiUrl, start)
+		body, _, err := c.get(ctx, pageUrl, settings)
+		if err != nil {
+			return nil, err
+		}
+
+		var response struct {
+			bitbucketPage[T]
+			Children *bitbucketPage[T] `json:"children"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+		page := response.bitbucketPage
+		if response.Children != nil {
+			page = *response.Children
+		}
+		all = append(all, page.Values...)
+
+		if page.IsLastPage {
+			return all, nil
+		}
+		if page.NextPageStart <= start {
+			return nil, fmt.Errorf("pagination doesn't advance at %v", pageUrl)
+		}
+		start = page.NextPageStart
+	}
+}
+
+// GetLFSObject opens the content of pointer from the Git LFS API of the repository
+func (b *Bitbucket) GetLFSObject(ctx context.Context, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error) {
+	return getLFSObject(ctx, b.Client, settings, pointer)
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// bitbucketServer serves a repository INFRA/wireguard with the branches main and feature/wg1 like the
+// Bitbucket Server API, the branches and the browse of conf have two pages
+func bitbucketServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	json := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			w.Write([]byte(body))
+		}
+	}
+	const repo = "/rest/api/latest/projects/INFRA/repos/wireguard"
+
+	mux.HandleFunc("GET "+repo, json(`{"slug": "wireguard", "project": {"key": "INFRA"}}`))
+	mux.HandleFunc("GET "+repo+"/branches", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Get("filterText") == "feature" || r.URL.Query().Get("filterText") == "feature/wg1":
+			json(`{"values": [{"displayId": "feature/wg1"}], "isLastPage": true}`)(w, r)
+		case r.URL.Query().Get("filterText") != "":
+			json(`{"values": [], "isLastPage": true}`)(w, r)
+		case r.URL.Query().Get("start") == "0":
+			json(`{"values": [{"displayId": "main"}], "isLastPage": false, "nextPageStart": 1}`)(w, r)
+		default:
+			json(`{"values": [{"displayId": "feature/wg1"}], "isLastPage": true}`)(w, r)
+		}
+	})
+	mux.HandleFunc("GET "+repo+"/tags/v1.0", json(`{"displayId": "v1.0"}`))
+	mux.HandleFunc("GET "+repo+"/commits/9fb037", json(`{"id": "9fb037"}`))
+	mux.HandleFunc("GET "+repo+"/browse/conf", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("at") != "main" {
+			t.Errorf("at = %q, want main", r.URL.Query().Get("at"))
+		}
+		if r.URL.Query().Get("start") == "0" {
+			json(`{"path": {"toString": "conf"}, "children": {"values": [
+				{"path": {"toString": "wg0.conf"}, "contentId": "c3", "type": "FILE"},
+				{"path": {"toString": "peers"}, "type": "DIRECTORY"}
+			], "isLastPage": false, "nextPageStart": 2}}`)(w, r)
+			return
+		}
+		json(`{"path": {"toString": "conf"}, "children": {"values": [
+			{"path": {"toString": "keys"}, "contentId": "e5", "type": "SUBMODULE"}
+		], "isLastPage": true}}`)(w, r)
+	})
+	mux.HandleFunc("GET "+repo+"/browse/conf/peers", json(`{"path": {"toString": "conf/peers"}, "children": {"values": [
+		{"path": {"toString": "laptop.conf"}, "contentId": "d4", "type": "FILE"}
+	], "isLastPage": true}}`))
+	mux.HandleFunc("GET "+repo+"/raw/conf/wg0.conf", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("at") != "main" {
+			t.Errorf("at = %q, want main", r.URL.Query().Get("at"))
+		}
+		json("[Interface]\n")(w, r)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	HttpGetFunc = httpGetInternal
+	HttpStreamFunc = httpStreamInternal
+	return server
+}
+
+func testBitbucket(t *testing.T, settings internal.Settings) *Bitbucket {
+	return &Bitbucket{Client: testClient(t, settings)}
+}
+
+func bitbucketSettings(server *httptest.Server) internal.Settings {
+	return internal.Settings{Provider: internal.ProviderBitbucket, ApiUrl: server.URL + "/rest/api/latest/", ProjectNumber: "INFRA/wireguard", PrivateToken: "token", Ref: "main"}
+}
+
+func TestBitbucket_ResolveRef(t *testing.T) {
+	server := bitbucketServer(t)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{ref: "feature/wg1", want: RefBranch},
+		{ref: "feature", wantErr: ErrRefNotFound},
+		{ref: "v1.0", want: RefTag},
+		{ref: "9fb037", want: RefCommit},
+		{ref: "missing", wantErr: ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			settings := bitbucketSettings(server)
+			settings.Ref = tt.ref
+			got, err := testBitbucket(t, settings).ResolveRef(context.Background(), settings)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveRef() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveRef() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBitbucket_GetBranches(t *testing.T) {
+	server := bitbucketServer(t)
+	settings := bitbucketSettings(server)
+
+	branches, err := testBitbucket(t, settings).GetBranches(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []Branch{{Name: "main"}, {Name: "feature/wg1"}}; !reflect.DeepEqual(branches, want) {
+		t.Errorf("branches = %+v, want %+v", branches, want)
+	}
+}
+
+func TestBitbucket_GetFilesFromFolderRecursive(t *testing.T) {
+	server := bitbucketServer(t)
+	settings := bitbucketSettings(server)
+	settings.RepoFolderPath = "conf"
+
+	files, err := testBitbucket(t, settings).GetFilesFromFolderRecursive(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []RepoFile{
+		{ID: "c3", Name: "wg0.conf", Type: "blob", Path: "conf/wg0.conf"},
+		{Name: "peers", Type: "tree", Path: "conf/peers", Mode: "040000"},
+		{ID: "d4", Name: "laptop.conf", Type: "blob", Path: "conf/peers/laptop.conf"},
+		{ID: "e5", Name: "keys", Type: "commit", Path: "conf/keys", Mode: "160000"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %+v, want %+v", files, want)
+	}
+}
+
+func TestBitbucket_GetFile(t *testing.T) {
+	server := bitbucketServer(t)
+	settings := bitbucketSettings(server)
+	settings.RepoFilePath = "conf/wg0.conf"
+
+	metadata, err := testBitbucket(t, settings).GetFileMetadata(context.Background(), settings)
+	if err != nil || metadata != (FileMetadata{BlobID: "c3"}) {
+		t.Errorf("GetFileMetadata() = %+v, %v", metadata, err)
+	}
+
+	body, err := testBitbucket(t, settings).GetFileRaw(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("GetFileRaw() error = %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil || string(data) != "[Interface]\n" {
+		t.Errorf("GetFileRaw() = %q, %v", data, err)
+	}
+}
+
+func TestBitbucket_GetProject(t *testing.T) {
+	server := bitbucketServer(t)
+	settings := bitbucketSettings(server)
+
+	project, err := testBitbucket(t, settings).GetProject(context.Background(), settings)
+	if err != nil || project != (Project{ID: "INFRA/wireguard", PathWithNamespace: "INFRA/wireguard"}) {
+		t.Errorf("GetProject() = %+v, %v", project, err)
+	}
+}
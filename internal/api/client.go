@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+var (
+	HttpGetFunc func(ctx context.Context, client *http.Client, apiUrl string, settings internal.Settings) ([]byte, http.Header, error) = httpGetInternal
+	// HttpStreamFunc is like HttpGetFunc, but the body is streamed instead of read into memory. The caller
+	// must close it.
+	HttpStreamFunc func(ctx context.Context, client *http.Client, apiUrl string, settings internal.Settings) (io.ReadCloser, http.Header, error) = httpStreamInternal
+	// HttpHeadFunc makes HTTP HEAD requests and returns the response headers
+	HttpHeadFunc func(ctx context.Context, client *http.Client, apiUrl string, settings internal.Settings) (http.Header, error) = httpHeadInternal
+	// HttpDoFunc sends a prepared request, for requests other than API GETs like the Git LFS batch API. The
+	// caller must close the body.
+	HttpDoFunc func(client *http.Client, req *http.Request) (io.ReadCloser, http.Header, error) = httpDoInternal
+)
+
+// Client calls the API of a provider, the connections of its http.Client are reused for all requests
+type Client struct {
+	httpClient *http.Client
+	retry      retryPolicy
+}
+
+// NewClient creates a Client with the TLS configuration and timeouts from the settings
+func NewClient(settings internal.Settings) (*Client, error) {
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   settings.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	tr := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   settings.ConnectTimeout,
+		ResponseHeaderTimeout: settings.Timeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	// settings.Timeout isn't the timeout of the http.Client, which would limit reading the whole body and
+	// cut off the download of a large file. It limits the wait for the response and for every read.
+	var transport http.RoundTripper = tr
+	if settings.Timeout > 0 {
+		transport = &idleTimeoutTransport{base: tr, timeout: settings.Timeout}
+	}
+	return &Client{
+		httpClient: &http.Client{
+			Transport: transport,
+		},
+		retry: retryPolicy{
+			retries: settings.Retries,
+			wait:    settings.RetryWait,
+			maxWait: settings.RetryMaxWait,
+		},
+	}, nil
+}
+
+// idleTimeoutTransport cancels a request if no data of the response body arrives within timeout
+type idleTimeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *idleTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	body := &idleTimeoutBody{ReadCloser: resp.Body, timeout: t.timeout, cancel: cancel}
+	body.timer = time.AfterFunc(t.timeout, body.expire)
+	resp.Body = body
+	return resp, nil
+}
+
+// idleTimeoutBody is a response body whose request is canceled if a read waits longer than timeout
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func (b *idleTimeoutBody) expire() {
+	b.expired.Store(true)
+	b.cancel()
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && b.expired.Load() {
+		return n, fmt.Errorf("no data received for %v: %w", b.timeout, os.ErrDeadlineExceeded)
+	}
+	b.timer.Reset(b.timeout)
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type acceptKey struct{}
+
+// withAccept returns ctx with the Accept header for the requests made with it, for APIs which select the
+// format of the response by it
+func withAccept(ctx context.Context, accept string) context.Context {
+	return context.WithValue(ctx, acceptKey{}, accept)
+}
+
+func setAccept(req *http.Request) {
+	if accept, ok := req.Context().Value(acceptKey{}).(string); ok {
+		req.Header.Set("Accept", accept)
+	}
+}
+
+func httpGetInternal(ctx context.Context, client *http.Client, apiUrl string, settings internal.Settings) ([]byte, http.Header, error) {
+	body, header, err := httpStreamInternal(ctx, client, apiUrl, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, header, nil
+}
+
+func httpHeadInternal(ctx context.Context, client *http.Client, apiUrl string, settings internal.Settings) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", apiUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	setAuth(req, settings)
+	setAccept(req)
+	req.Header.Add("User-Agent", settings.UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, &HttpError{Method: req.Method, StatusCode: resp.StatusCode, Header: resp.Header}
+	}
+	return resp.Header, nil
+}
+
+func httpStreamInternal(ctx context.Context, client *http.Client, apiUrl string, settings internal.Settings) (io.ReadCloser, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiUrl, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	setAuth(req, settings)
+	setAccept(req)
+	req.Header.Add("User-Agent", settings.UserAgent)
+	return httpDoInternal(client, req)
+}
+
+func httpDoInternal(client *http.Client, req *http.Request) (io.ReadCloser, http.Header, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		// Drain the body, so the connection can be reused
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, nil, &HttpError{Method: req.Method, StatusCode: resp.StatusCode, Header: resp.Header}
+	}
+	return resp.Body, resp.Header, nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+func TestHttpGetInternal_TimeoutAndCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	t.Run("Timeout", func(t *testing.T) {
+		settings := internal.Settings{Timeout: 50 * time.Millisecond}
+		client := testClient(t, settings)
+
+		_, _, err := httpGetInternal(context.Background(), client.httpClient, server.URL, settings)
+		if err == nil {
+			t.Fatal("expected timeout error, got nil")
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		settings := internal.Settings{}
+		client := testClient(t, settings)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		_, _, err := httpGetInternal(ctx, client.httpClient, server.URL, settings)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestNewClient_TimeoutPerRead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every chunk is within the timeout, the whole body takes longer
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("chunk\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+		if r.URL.Query().Get("stall") != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	settings := internal.Settings{Timeout: 80 * time.Millisecond}
+	client := testClient(t, settings)
+
+	data, _, err := httpGetInternal(context.Background(), client.httpClient, server.URL, settings)
+	if err != nil || len(data) != 30 {
+		t.Errorf("httpGetInternal() = %q, %v, want 5 chunks", data, err)
+	}
+
+	_, _, err = httpGetInternal(context.Background(), client.httpClient, server.URL+"?stall=1", settings)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("httpGetInternal() of a stalled body error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+}
+
+func TestNewClient_ReusesConnections(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	settings := internal.Settings{}
+	client := testClient(t, settings)
+	for i := 0; i < 3; i++ {
+		if _, _, err := httpGetInternal(context.Background(), client.httpClient, server.URL, settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if connections.Load() != 1 {
+		t.Errorf("expected 1 connection, got %d", connections.Load())
+	}
+}
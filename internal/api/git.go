@@ -0,0 +1,553 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// gitCommand is the git binary which reads the repositories of the Git provider
+var gitCommand = "git"
+
+// Git is the Provider for a git repository without an API, read with the git command. settings.ApiUrl is
+// the path or file:// URL of a local repository, which is read as it is, or the http(s) URL of a remote,
+// which is fetched shallow into a bare repository below settings.GitCache. The Client requests the Git
+// LFS objects of a remote.
+type Git struct {
+	*Client
+
+	// commits caches the resolved refs of every repository, so a remote is fetched once per run
+	mu      sync.Mutex
+	commits map[string]gitCommit
+}
+
+// gitCommit is a resolved ref, kind is RefBranch, RefTag or RefCommit
+type gitCommit struct {
+	kind string
+	// sha is the commit, while resolving it is the full name of the ref
+	sha string
+}
+
+// isRemote returns whether the repository is fetched over smart HTTP
+func (g *Git) isRemote(settings internal.Settings) bool {
+	return strings.HasPrefix(settings.ApiUrl, "https://") || strings.HasPrefix(settings.ApiUrl, "http://")
+}
+
+// repoDir returns the folder git runs in, the local repository or the cache of the remote
+func (g *Git) repoDir(settings internal.Settings) (string, error) {
+	if !g.isRemote(settings) {
+		if !internal.IsFileUrl(settings.ApiUrl) {
+			return settings.ApiUrl, nil
+		}
+		return fileUrlPath(settings.ApiUrl)
+	}
+
+	cache := settings.GitCache
+	if cache == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("no %v: %v", internal.FlagNameGitCache, err)
+		}
+		cache = filepath.Join(userCache, "gdown", "git")
+	}
+	sum := sha256.Sum256([]byte(settings.ApiUrl))
+	return filepath.Join(cache, hex.EncodeToString(sum[:8])+".git"), nil
+}
+
+// fileUrlPath returns the local path of a file:// URL. The slash before a Windows drive letter like in
+// file:///C:/repos/config.git is removed, a host is the server of a UNC path.
+func fileUrlPath(fileUrl string) (string, error) {
+	u, err := url.Parse(fileUrl)
+	if err != nil {
+		return "", err
+	}
+	p := u.Path
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' && ('a' <= p[1] && p[1] <= 'z' || 'A' <= p[1] && p[1] <= 'Z') {
+		p = p[1:]
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		p = "//" + u.Host + p
+	}
+	return filepath.FromSlash(p), nil
+}
+
+func (g *Git) GetBranches(ctx context.Context, settings internal.Settings) ([]Branch, error) {
+	var names []string
+	if g.isRemote(settings) {
+		refs, err := g.lsRemote(ctx, settings, "--heads")
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			names = append(names, strings.TrimPrefix(ref.name, "refs/heads/"))
+		}
+	} else {
+		dir, err := g.repoDir(settings)
+		if err != nil {
+			return nil, err
+		}
+		output, err := g.git(ctx, settings, dir, "for-each-ref", "--format=%(refname:strip=2)", "refs/heads/")
+		if err != nil {
+			return nil, err
+		}
+		names = strings.Fields(string(output))
+	}
+
+	var branches []Branch
+	for _, name := range names {
+		branches = append(branches, Branch{Name: name})
+	}
+	return branches, nil
+}
+
+// ResolveRef returns whether settings.Ref is a branch, tag or commit. A remote is fetched for it.
+func (g *Git) ResolveRef(ctx context.Context, settings internal.Settings) (string, error) {
+	commit, err := g.commit(ctx, settings)
+	return commit.kind, err
+}
+
+// commit returns the resolved settings.Ref, it is only resolved once per repository
+func (g *Git) commit(ctx context.Context, settings internal.Settings) (gitCommit, error) {
+	key := settings.ApiUrl + " " + settings.Ref
+	g.mu.Lock()
+	commit, ok := g.commits[key]
+	g.mu.Unlock()
+	if ok {
+		return commit, nil
+	}
+
+	// A ref starting with a dash would be an option of git
+	if settings.Ref == "" || strings.HasPrefix(settings.Ref, "-") {
+		return gitCommit{}, fmt.Errorf("%w: %v is no branch, tag or commit", ErrRefNotFound, settings.Ref)
+	}
+	var err error
+	if g.isRemote(settings) {
+		commit, err = g.fetch(ctx, settings)
+	} else {
+		commit, err = g.resolveLocal(ctx, settings)
+	}
+	if err != nil {
+		return gitCommit{}, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.commits == nil {
+		g.commits = make(map[string]gitCommit)
+	}
+	g.commits[key] = commit
+	return commit, nil
+}
+
+// resolveLocal looks settings.Ref up in the local repository like ResolveRef of the APIs does: branch,
+// tag, then commit
+func (g *Git) resolveLocal(ctx context.Context, settings internal.Settings) (gitCommit, error) {
+	dir, err := g.repoDir(settings)
+	if err != nil {
+		return gitCommit{}, err
+	}
+	if _, err := g.git(ctx, settings, dir, "rev-parse", "--git-dir"); err != nil {
+		return gitCommit{}, err
+	}
+
+	candidates := []gitCommit{{kind: RefBranch, sha: "refs/heads/" + settings.Ref}, {kind: RefTag, sha: "refs/tags/" + settings.Ref}}
+	if commitPattern.MatchString(settings.Ref) {
+		candidates = append(candidates, gitCommit{kind: RefCommit, sha: settings.Ref})
+	}
+	for _, candidate := range candidates {
+		sha, err := g.revParse(ctx, settings, dir, candidate.sha)
+		if err != nil {
+			return gitCommit{}, err
+		}
+		if sha != "" {
+			return gitCommit{kind: candidate.kind, sha: sha}, nil
+		}
+	}
+	return gitCommit{}, fmt.Errorf("%w: %v is no branch, tag or commit", ErrRefNotFound, settings.Ref)
+}
+
+// revParse returns the commit of rev in dir, or an empty string if there is no such commit
+func (g *Git) revParse(ctx context.Context, settings internal.Settings, dir, rev string) (string, error) {
+	output, err := g.git(ctx, settings, dir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// fetch resolves settings.Ref on the remote and fetches its commit with depth 1 into the cache. The refs
+// of the remote are listed first, a commit SHA must be complete, as servers don't resolve abbreviated SHAs.
+func (g *Git) fetch(ctx context.Context, settings internal.Settings) (gitCommit, error) {
+	dir, err := g.repoDir(settings)
+	if err != nil {
+		return gitCommit{}, err
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return gitCommit{}, err
+		}
+		if _, err := g.git(ctx, settings, dir, "init", "--bare", "--quiet"); err != nil {
+			return gitCommit{}, err
+		}
+	}
+
+	refs, err := g.lsRemote(ctx, settings, "--heads", "--tags", "--", "refs/heads/"+settings.Ref, "refs/tags/"+settings.Ref)
+	if err != nil {
+		return gitCommit{}, err
+	}
+	commit := gitCommit{}
+	for _, ref := range refs {
+		switch ref.name {
+		case "refs/heads/" + settings.Ref:
+			commit = gitCommit{kind: RefBranch, sha: ref.name}
+		case "refs/tags/" + settings.Ref:
+			if commit.kind == "" {
+				commit = gitCommit{kind: RefTag, sha: ref.name}
+			}
+		}
+	}
+	if commit.kind == "" {
+		if len(settings.Ref) != 40 && len(settings.Ref) != 64 || !commitPattern.MatchString(settings.Ref) {
+			return gitCommit{}, fmt.Errorf("%w: %v is no branch, tag or full commit SHA", ErrRefNotFound, settings.Ref)
+		}
+		commit = gitCommit{kind: RefCommit, sha: settings.Ref}
+		// A commit fetched before is still in the cache
+		if sha, err := g.revParse(ctx, settings, dir, settings.Ref); err == nil && sha != "" {
+			commit.sha = sha
+			return commit, nil
+		}
+	}
+
+	// A large fetch takes as long as data arrives, git itself aborts it if it stalls for settings.Timeout
+	if _, err := g.run(ctx, settings, dir, "fetch", "--depth=1", "--no-tags", "--quiet", settings.ApiUrl, commit.sha); err != nil {
+		return gitCommit{}, err
+	}
+	sha, err := g.revParse(ctx, settings, dir, "FETCH_HEAD")
+	if err != nil {
+		return gitCommit{}, err
+	}
+	if sha == "" {
+		return gitCommit{}, fmt.Errorf("%v of %v is no commit", settings.Ref, settings.ApiUrl)
+	}
+	commit.sha = sha
+	return commit, nil
+}
+
+type gitRef struct {
+	sha  string
+	name string
+}
+
+// lsRemote lists the refs of the remote settings.ApiUrl, args are options of git ls-remote and after --
+// the patterns of the refs
+func (g *Git) lsRemote(ctx context.Context, settings internal.Settings, args ...string) ([]gitRef, error) {
+	options, patterns, _ := cutArgs(args, "--")
+	lsArgs := append(append([]string{"ls-remote"}, options...), settings.ApiUrl)
+	// ls-remote needs no repository, it runs in the current directory
+	output, err := g.git(ctx, settings, ".", append(lsArgs, patterns...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []gitRef
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		sha, name, found := strings.Cut(line, "\t")
+		if found {
+			refs = append(refs, gitRef{sha: sha, name: name})
+		}
+	}
+	return refs, nil
+}
+
+// cutArgs splits args around the first sep
+func cutArgs(args []string, sep string) ([]string, []string, bool) {
+	for i, arg := range args {
+		if arg == sep {
+			return args[:i], args[i+1:], true
+		}
+	}
+	return args, nil, false
+}
+
+// GetProject isn't supported, a git repository has no projects to look submodules up
+func (g *Git) GetProject(ctx context.Context, settings internal.Settings) (Project, error) {
+	return Project{}, fmt.Errorf("%v has no projects, submodules can't be synced", internal.ProviderGit)
+}
+
+// GetFilesFromFolderRecursive lists all files and folders below settings.RepoFolderPath with git ls-tree
+func (g *Git) GetFilesFromFolderRecursive(ctx context.Context, settings internal.Settings) ([]RepoFile, error) {
+	commit, err := g.commit(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := g.repoDir(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"ls-tree", "-r", "-t", "-z", "--full-tree", commit.sha}
+	if folder := strings.Trim(settings.RepoFolderPath, "/"); folder != "" && folder != "." {
+		args = append(args, "--", folder)
+	}
+	output, err := g.git(ctx, settings, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseLsTree(output)
+	if err != nil {
+		return nil, err
+	}
+	return folderFiles(entries, settings)
+}
+
+// parseLsTree parses the -z output of git ls-tree, every entry is the mode, type and object, a tab and
+// the path
+func parseLsTree(output []byte) ([]gitTreeEntry, error) {
+	var entries []gitTreeEntry
+	for _, line := range strings.Split(string(output), "\x00") {
+		if line == "" {
+			continue
+		}
+		info, entryPath, found := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if !found || len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected git ls-tree output %q", line)
+		}
+		entries = append(entries, gitTreeEntry{Mode: fields[0], Type: fields[1], Sha: fields[2], Path: entryPath})
+	}
+	return entries, nil
+}
+
+// GetFileMetadata returns the blob ID of settings.RepoFilePath. In folder mode the blob ID is known from
+// the tree, otherwise it is looked up with git ls-tree.
+func (g *Git) GetFileMetadata(ctx context.Context, settings internal.Settings) (FileMetadata, error) {
+	if settings.RepoFileID != "" {
+		return FileMetadata{BlobID: settings.RepoFileID}, nil
+	}
+
+	commit, err := g.commit(ctx, settings)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	dir, err := g.repoDir(settings)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	output, err := g.git(ctx, settings, dir, "ls-tree", "-z", "--full-tree", commit.sha, "--", strings.Trim(settings.RepoFilePath, "/"))
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	entries, err := parseLsTree(output)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	if len(entries) == 0 {
+		return FileMetadata{}, fmt.Errorf("%v not found at %v", settings.RepoFilePath, settings.Ref)
+	}
+	if entries[0].Type != "blob" {
+		return FileMetadata{}, fmt.Errorf("%v is a %v, not a file", settings.RepoFilePath, entries[0].Type)
+	}
+	return FileMetadata{BlobID: entries[0].Sha}, nil
+}
+
+// GetFileRaw streams the blob of settings.RepoFilePath from git cat-file, a symlink is its target. The
+// caller must close it.
+func (g *Git) GetFileRaw(ctx context.Context, settings internal.Settings) (io.ReadCloser, error) {
+	commit, err := g.commit(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := g.repoDir(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	object := commit.sha + ":" + strings.Trim(settings.RepoFilePath, "/")
+	if settings.RepoFileID != "" {
+		object = settings.RepoFileID
+	}
+	cmd := g.command(ctx, settings, dir, "cat-file", "blob", object)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	reader := &gitBlobReader{ReadCloser: stdout, cmd: cmd}
+	cmd.Stderr = &reader.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// GetLFSObject opens the content of pointer. A remote has it on its Git LFS API, a local repository in
+// its LFS storage, where git lfs fetch puts it.
+func (g *Git) GetLFSObject(ctx context.Context, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error) {
+	if g.isRemote(settings) {
+		return getLFSObject(ctx, g.Client, settings, pointer)
+	}
+
+	dir, err := g.repoDir(settings)
+	if err != nil {
+		return nil, err
+	}
+	output, err := g.git(ctx, settings, dir, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return nil, err
+	}
+	gitDir := strings.TrimSpace(string(output))
+	file, err := os.Open(filepath.Join(gitDir, "lfs", "objects", pointer.Oid[0:2], pointer.Oid[2:4], pointer.Oid))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %v is not in %v, run git lfs fetch", ErrLFSObjectNotFound, pointer.Oid, gitDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// gitBlobReader is the output of git cat-file, an error of git is returned at the end of the content
+type gitBlobReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	waited bool
+	err    error
+}
+
+func (r *gitBlobReader) Read(p []byte) (int, error) {
+	// git is done and its output closed, like after a buffered reader saw the end
+	if r.waited {
+		if r.err != nil {
+			return 0, r.err
+		}
+		return 0, io.EOF
+	}
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		if waitErr := r.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close stops git if the content wasn't read to the end
+func (r *gitBlobReader) Close() error {
+	if r.waited {
+		return nil
+	}
+	r.ReadCloser.Close()
+	r.cmd.Process.Kill()
+	r.wait()
+	return nil
+}
+
+func (r *gitBlobReader) wait() error {
+	if !r.waited {
+		r.waited = true
+		if err := r.cmd.Wait(); err != nil {
+			r.err = fmt.Errorf("git cat-file: %v %v", err, strings.TrimSpace(r.stderr.String()))
+		}
+	}
+	return r.err
+}
+
+// git runs git in dir and returns its output, the error contains the message of git. settings.Timeout
+// limits it like a request.
+func (g *Git) git(ctx context.Context, settings internal.Settings, dir string, args ...string) ([]byte, error) {
+	if settings.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.Timeout)
+		defer cancel()
+	}
+	return g.run(ctx, settings, dir, args...)
+}
+
+// run runs git in dir like git, but without limiting the whole command to settings.Timeout
+func (g *Git) run(ctx context.Context, settings internal.Settings, dir string, args ...string) ([]byte, error) {
+	cmd := g.command(ctx, settings, dir, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, &gitError{args: args[0], message: strings.TrimSpace(stderr.String()), err: err}
+	}
+	return output, nil
+}
+
+// gitError is a failed git command, it unwraps to the *exec.ExitError
+type gitError struct {
+	args    string
+	message string
+	err     error
+}
+
+func (e *gitError) Error() string {
+	return fmt.Sprintf("git %v: %v %v", e.args, e.err, e.message)
+}
+
+func (e *gitError) Unwrap() error {
+	return e.err
+}
+
+// command creates the git command in dir. git never prompts, the token and the TLS settings are passed as
+// git config in the environment, so the token isn't visible in the process list.
+func (g *Git) command(ctx context.Context, settings internal.Settings, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, gitCommand, append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+
+	var config [][2]string
+	if settings.PrivateToken != "" {
+		config = append(config, [2]string{"http.extraHeader", gitAuthHeader(settings)})
+	}
+	if settings.Insecure {
+		config = append(config, [2]string{"http.sslVerify", "false"})
+	}
+	if settings.CACertFile != "" {
+		config = append(config, [2]string{"http.sslCAInfo", settings.CACertFile})
+	}
+	if settings.ClientCertFile != "" {
+		config = append(config, [2]string{"http.sslCert", settings.ClientCertFile}, [2]string{"http.sslKey", settings.ClientKeyFile})
+	}
+	if settings.Timeout > 0 {
+		// Less than a byte per second for the timeout, in whole seconds, aborts a transfer
+		seconds := int64((settings.Timeout + time.Second - 1) / time.Second)
+		config = append(config, [2]string{"http.lowSpeedLimit", "1"}, [2]string{"http.lowSpeedTime", strconv.FormatInt(seconds, 10)})
+	}
+	if len(config) > 0 {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_CONFIG_COUNT=%v", len(config)))
+		for i, c := range config {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_CONFIG_KEY_%v=%v", i, c[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%v=%v", i, c[1]))
+		}
+	}
+	return cmd
+}
+
+// gitAuthHeader returns the header setGitAuth sends the token with, like "Authorization: Basic ..."
+func gitAuthHeader(settings internal.Settings) string {
+	req := &http.Request{Header: http.Header{}}
+	setGitAuth(req, settings)
+	for name, values := range req.Header {
+		return name + ": " + values[0]
+	}
+	return ""
+}
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// gitRepo creates a bare repository config.git in a temporary folder with the branches main and
+// feature/wg1 and the tag v1.0, it returns the folder
+func gitRepo(t *testing.T) string {
+	if _, err := exec.LookPath(gitCommand); err != nil {
+		t.Skip("git not found")
+	}
+	folder := t.TempDir()
+	work := filepath.Join(folder, "work")
+	files := map[string]string{
+		"README.md":              "# config\n",
+		"conf/wg0.conf":          "[Interface]\n",
+		"conf/peers/laptop.conf": "[Peer]\n",
+		"conf/up.sh":             "#!/bin/sh\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(work, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(work, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(dir string, args ...string) {
+		cmd := exec.Command(gitCommand, append([]string{"-c", "user.name=gdown", "-c", "user.email=gdown@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, output)
+		}
+	}
+	run(work, "init", "--quiet")
+	run(work, "add", ".")
+	run(work, "update-index", "--chmod=+x", "conf/up.sh")
+	run(work, "commit", "--quiet", "-m", "Initial")
+	run(work, "tag", "v1.0")
+	run(work, "branch", "feature/wg1")
+	run(folder, "clone", "--quiet", "--bare", work, "config.git")
+	return folder
+}
+
+// gitOutput runs git in dir and returns the trimmed output
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	output, err := exec.Command(gitCommand, append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		t.Fatalf("git %v: %v", args, err)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func gitSettings(folder string) internal.Settings {
+	return internal.Settings{Provider: internal.ProviderGit, ApiUrl: "file:///" + strings.TrimPrefix(filepath.ToSlash(filepath.Join(folder, "config.git")), "/"), Ref: "main"}
+}
+
+func Test_fileUrlPath(t *testing.T) {
+	tests := []struct {
+		fileUrl string
+		want    string
+	}{
+		{fileUrl: "file:///srv/git/config.git", want: "/srv/git/config.git"},
+		{fileUrl: "file://localhost/srv/git/config.git", want: "/srv/git/config.git"},
+		{fileUrl: "file:///C:/repos/config.git", want: "C:/repos/config.git"},
+		{fileUrl: "file:///c:/my%20repos/config.git", want: "c:/my repos/config.git"},
+		{fileUrl: "file://server/share/config.git", want: "//server/share/config.git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileUrl, func(t *testing.T) {
+			got, err := fileUrlPath(tt.fileUrl)
+			if err != nil || got != filepath.FromSlash(tt.want) {
+				t.Errorf("fileUrlPath() = %v, %v, want %v", got, err, filepath.FromSlash(tt.want))
+			}
+		})
+	}
+}
+
+func TestGit_ResolveRef(t *testing.T) {
+	folder := gitRepo(t)
+	commit := gitOutput(t, filepath.Join(folder, "config.git"), "rev-parse", "main")
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{ref: "main", want: RefBranch},
+		{ref: "feature/wg1", want: RefBranch},
+		{ref: "v1.0", want: RefTag},
+		{ref: commit[:7], want: RefCommit},
+		{ref: "missing", wantErr: ErrRefNotFound},
+		{ref: "--output=x", wantErr: ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			settings := gitSettings(folder)
+			settings.Ref = tt.ref
+			got, err := (&Git{}).ResolveRef(context.Background(), settings)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveRef() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveRef() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGit_ResolveRef_NoRepository(t *testing.T) {
+	if _, err := exec.LookPath(gitCommand); err != nil {
+		t.Skip("git not found")
+	}
+	settings := gitSettings(t.TempDir())
+	if _, err := (&Git{}).ResolveRef(context.Background(), settings); err == nil || errors.Is(err, ErrRefNotFound) {
+		t.Errorf("ResolveRef() error = %v, want git error", err)
+	}
+}
+
+func TestGit_GetBranches(t *testing.T) {
+	folder := gitRepo(t)
+	settings := gitSettings(folder)
+
+	branches, err := (&Git{}).GetBranches(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []Branch{{Name: "feature/wg1"}, {Name: "main"}}; !reflect.DeepEqual(branches, want) {
+		t.Errorf("branches = %+v, want %+v", branches, want)
+	}
+}
+
+func TestGit_GetFilesFromFolderRecursive(t *testing.T) {
+	folder := gitRepo(t)
+	repo := filepath.Join(folder, "config.git")
+	settings := gitSettings(folder)
+	settings.RepoFolderPath = "conf"
+
+	files, err := (&Git{}).GetFilesFromFolderRecursive(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	blob := func(path string) string { return gitOutput(t, repo, "rev-parse", "main:"+path) }
+	want := []RepoFile{
+		{ID: blob("conf/peers"), Name: "peers", Type: "tree", Path: "conf/peers", Mode: "040000"},
+		{ID: blob("conf/peers/laptop.conf"), Name: "laptop.conf", Type: "blob", Path: "conf/peers/laptop.conf", Mode: "100644"},
+		{ID: blob("conf/up.sh"), Name: "up.sh", Type: "blob", Path: "conf/up.sh", Mode: "100755"},
+		{ID: blob("conf/wg0.conf"), Name: "wg0.conf", Type: "blob", Path: "conf/wg0.conf", Mode: "100644"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %+v, want %+v", files, want)
+	}
+
+	settings.RepoFolderPath = "missing"
+	if _, err := (&Git{}).GetFilesFromFolderRecursive(context.Background(), settings); err == nil {
+		t.Error("expected an error for a missing folder")
+	}
+}
+
+func TestGit_GetFile(t *testing.T) {
+	folder := gitRepo(t)
+	settings := gitSettings(folder)
+	settings.ApiUrl = filepath.Join(folder, "config.git")
+	settings.RepoFilePath = "conf/wg0.conf"
+	git := &Git{}
+
+	metadata, err := git.GetFileMetadata(context.Background(), settings)
+	want := gitOutput(t, settings.ApiUrl, "rev-parse", "main:conf/wg0.conf")
+	if err != nil || metadata != (FileMetadata{BlobID: want}) {
+		t.Errorf("GetFileMetadata() = %+v, %v", metadata, err)
+	}
+
+	data, err := ReadFile(context.Background(), git, settings)
+	if err != nil || string(data) != "[Interface]\n" {
+		t.Errorf("GetFileRaw() = %q, %v", data, err)
+	}
+
+	settings.RepoFilePath = "conf/missing.conf"
+	if _, err := git.GetFileMetadata(context.Background(), settings); err == nil {
+		t.Error("GetFileMetadata() expected an error for a missing file")
+	}
+	if _, err := ReadFile(context.Background(), git, settings); err == nil {
+		t.Error("GetFileRaw() expected an error for a missing file")
+	}
+}
+
+func TestGit_Remote(t *testing.T) {
+	folder := gitRepo(t)
+	backend := filepath.Join(gitOutput(t, folder, "--exec-path"), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git-http-backend not found")
+	}
+	handler := &cgi.Handler{Path: backend, Env: []string{"GIT_PROJECT_ROOT=" + folder, "GIT_HTTP_EXPORT_ALL=1"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, _ := r.BasicAuth(); password != "token" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	settings := internal.Settings{Provider: internal.ProviderGit, ApiUrl: server.URL + "/config.git", GitCache: t.TempDir(), PrivateToken: "token", Ref: "v1.0", RepoFilePath: "conf/wg0.conf"}
+	git := &Git{}
+	kind, err := git.ResolveRef(context.Background(), settings)
+	if err != nil || kind != RefTag {
+		t.Fatalf("ResolveRef() = %v, %v, want %v", kind, err, RefTag)
+	}
+	body, err := git.GetFileRaw(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("GetFileRaw() error = %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil || string(data) != "[Interface]\n" {
+		t.Errorf("GetFileRaw() = %q, %v", data, err)
+	}
+
+	branches, err := git.GetBranches(context.Background(), settings)
+	if want := []Branch{{Name: "feature/wg1"}, {Name: "main"}}; err != nil || !reflect.DeepEqual(branches, want) {
+		t.Errorf("GetBranches() = %+v, %v, want %+v", branches, err, want)
+	}
+
+	settings.PrivateToken = "wrong"
+	if _, err := (&Git{}).ResolveRef(context.Background(), settings); err == nil {
+		t.Error("ResolveRef() with a wrong token expected an error")
+	}
+}
+
+func TestGit_Remote_SlowFetch(t *testing.T) {
+	folder := gitRepo(t)
+	backend := filepath.Join(gitOutput(t, folder, "--exec-path"), "git-http-backend")
+	if _, err := os.Stat(backend); err != nil {
+		t.Skip("git-http-backend not found")
+	}
+	handler := &cgi.Handler{Path: backend, Env: []string{"GIT_PROJECT_ROOT=" + folder, "GIT_HTTP_EXPORT_ALL=1"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		// The fetch of the objects takes longer than the timeout, listing the refs doesn't
+		if bytes.Contains(body, []byte("command=fetch")) || bytes.Contains(body, []byte("want ")) {
+			time.Sleep(500 * time.Millisecond)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	settings := internal.Settings{Provider: internal.ProviderGit, ApiUrl: server.URL + "/config.git", GitCache: t.TempDir(), Ref: "main", Timeout: 200 * time.Millisecond}
+	if kind, err := (&Git{}).ResolveRef(context.Background(), settings); err != nil || kind != RefBranch {
+		t.Errorf("ResolveRef() = %v, %v, want %v", kind, err, RefBranch)
+	}
+}
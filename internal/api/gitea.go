@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// Gitea is the Provider for the API v1 of Gitea and Forgejo (https://host/api/v1/). The project is
+// owner/repo.
+type Gitea struct {
+	*Client
+}
+
+func (g *Gitea) repoUrl(settings internal.Settings) string {
+	return fmt.Sprintf("%vrepos/%v", settings.ApiUrl, settings.RepoPathEscaped())
+}
+
+func (g *Gitea) GetBranches(ctx context.Context, settings internal.Settings) ([]Branch, error) {
+	apiUrl := fmt.Sprintf("%v/branches?limit=%v", g.repoUrl(settings), perPage)
+	return getAllPages[Branch](ctx, g.Client, apiUrl, settings)
+}
+
+// ResolveRef returns whether settings.Ref is a branch, tag or commit, like GitLab.ResolveRef does. The
+// routes of branches and tags take names with slashes as they are.
+func (g *Gitea) ResolveRef(ctx context.Context, settings internal.Settings) (string, error) {
+	return resolveRef(ctx, g.Client, settings, []refUrl{
+		{kind: RefBranch, url: fmt.Sprintf("%v/branches/%v", g.repoUrl(settings), escapePath(settings.Ref))},
+		{kind: RefTag, url: fmt.Sprintf("%v/tags/%v", g.repoUrl(settings), escapePath(settings.Ref))},
+		{kind: RefCommit, url: fmt.Sprintf("%v/git/commits/%v", g.repoUrl(settings), url.PathEscape(settings.Ref))},
+	})
+}
+
+// GetProject returns the repository settings.ProjectNumber, the ID is owner/repo like for GitHub
+func (g *Gitea) GetProject(ctx context.Context, settings internal.Settings) (Project, error) {
+	body, _, err := g.get(ctx, g.repoUrl(settings), settings)
+	if err != nil {
+		return Project{}, err
+	}
+
+	var repo repository
+	if err := json.Unmarshal(body, &repo); err != nil {
+		return Project{}, err
+	}
+	return Project{ID: repo.FullName, PathWithNamespace: repo.FullName}, nil
+}
+
+// GetFilesFromFolderRecursive lists all files and folders below settings.RepoFolderPath. The recursive
+// tree of the whole repository is paged, truncated means there are more pages.
+func (g *Gitea) GetFilesFromFolderRecursive(ctx context.Context, settings internal.Settings) ([]RepoFile, error) {
+	var entries []gitTreeEntry
+	for page := 1; ; page++ {
+		apiUrl := fmt.Sprintf("%v/git/trees/%v?recursive=true&page=%v", g.repoUrl(settings), url.PathEscape(settings.Ref), page)
+		body, _, err := g.get(ctx, apiUrl, settings)
+		if err != nil {
+			return nil, err
+		}
+
+		var tree gitTree
+		if err := json.Unmarshal(body, &tree); err != nil {
+			return nil, err
+		}
+		entries = append(entries, tree.Tree...)
+		if !tree.Truncated {
+			break
+		}
+		if len(tree.Tree) == 0 {
+			return nil, fmt.Errorf("pagination doesn't advance at %v", apiUrl)
+		}
+	}
+	return folderFiles(entries, settings)
+}
+
+// GetFileMetadata returns the blob ID of settings.RepoFilePath, Gitea has no SHA-256 of the content. In
+// folder mode the blob ID is known from the tree, otherwise the contents API is asked.
+func (g *Gitea) GetFileMetadata(ctx context.Context, settings internal.Settings) (FileMetadata, error) {
+	if settings.RepoFileID != "" {
+		return FileMetadata{BlobID: settings.RepoFileID}, nil
+	}
+
+	apiUrl := fmt.Sprintf("%v/contents/%v?ref=%v", g.repoUrl(settings), escapePath(settings.RepoFilePath), url.QueryEscape(settings.Ref))
+	body, _, err := g.get(ctx, apiUrl, settings)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	return contentsMetadata(body, settings)
+}
+
+// GetFileRaw opens the content of settings.RepoFilePath from the raw endpoint, a symlink is its target.
+// The caller must close it.
+func (g *Gitea) GetFileRaw(ctx context.Context, settings internal.Settings) (io.ReadCloser, error) {
+	apiUrl := fmt.Sprintf("%v/raw/%v?ref=%v", g.repoUrl(settings), escapePath(settings.RepoFilePath), url.QueryEscape(settings.Ref))
+	body, _, err := g.stream(ctx, apiUrl, settings)
+	return body, err
+}
+
+// GetLFSObject opens the content of pointer from the Git LFS API of the repository
+func (g *Gitea) GetLFSObject(ctx context.Context, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error) {
+	return getLFSObject(ctx, g.Client, settings, pointer)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// giteaServer serves a repository infra/wireguard with the branches main and feature/wg1 like the Gitea
+// API, the tree has two pages
+func giteaServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	json := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			w.Write([]byte(body))
+		}
+	}
+
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard", json(`{"id": 7, "full_name": "infra/wireguard"}`))
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/branches", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", `<http://`+r.Host+`/api/v1/repos/infra/wireguard/branches?limit=100&page=2>; rel="next"`)
+			json(`[{"name": "main"}]`)(w, r)
+			return
+		}
+		json(`[{"name": "feature/wg1"}]`)(w, r)
+	})
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/branches/main", json(`{"name": "main"}`))
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/branches/feature/wg1", json(`{"name": "feature/wg1"}`))
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/tags/v1.0", json(`{"name": "v1.0"}`))
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/git/commits/9fb037", json(`{"sha": "9fb037"}`))
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/git/trees/main", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("recursive") != "true" {
+			t.Errorf("recursive = %q, want true", r.URL.Query().Get("recursive"))
+		}
+		if r.URL.Query().Get("page") == "1" {
+			json(`{"sha": "9fb037", "truncated": true, "page": 1, "tree": [
+				{"path": "README.md", "mode": "100644", "type": "blob", "sha": "a1"},
+				{"path": "conf", "mode": "040000", "type": "tree", "sha": "b2"}
+			]}`)(w, r)
+			return
+		}
+		json(`{"sha": "9fb037", "truncated": false, "page": 2, "tree": [
+			{"path": "conf/wg0.conf", "mode": "100644", "type": "blob", "sha": "c3"},
+			{"path": "conf/wg1.conf", "mode": "120000", "type": "blob", "sha": "d4"}
+		]}`)(w, r)
+	})
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/contents/conf/wg0.conf", json(`{"type": "file", "sha": "c3", "content": "W0ludGVyZmFjZV0K"}`))
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/raw/conf/wg0.conf", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "main" {
+			t.Errorf("ref = %q, want main", r.URL.Query().Get("ref"))
+		}
+		json("[Interface]\n")(w, r)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	HttpGetFunc = httpGetInternal
+	HttpStreamFunc = httpStreamInternal
+	return server
+}
+
+func testGitea(t *testing.T, settings internal.Settings) *Gitea {
+	return &Gitea{Client: testClient(t, settings)}
+}
+
+func giteaSettings(server *httptest.Server) internal.Settings {
+	return internal.Settings{Provider: internal.ProviderGitea, ApiUrl: server.URL + "/api/v1/", ProjectNumber: "infra/wireguard", PrivateToken: "token", Ref: "main"}
+}
+
+func TestGitea_ResolveRef(t *testing.T) {
+	server := giteaServer(t)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{ref: "main", want: RefBranch},
+		{ref: "feature/wg1", want: RefBranch},
+		{ref: "v1.0", want: RefTag},
+		{ref: "9fb037", want: RefCommit},
+		{ref: "missing", wantErr: ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			settings := giteaSettings(server)
+			settings.Ref = tt.ref
+			got, err := testGitea(t, settings).ResolveRef(context.Background(), settings)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveRef() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveRef() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitea_GetBranches(t *testing.T) {
+	server := giteaServer(t)
+	settings := giteaSettings(server)
+
+	branches, err := testGitea(t, settings).GetBranches(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := []Branch{{Name: "main"}, {Name: "feature/wg1"}}; !reflect.DeepEqual(branches, want) {
+		t.Errorf("branches = %+v, want %+v", branches, want)
+	}
+}
+
+func TestGitea_GetFilesFromFolderRecursive(t *testing.T) {
+	server := giteaServer(t)
+	settings := giteaSettings(server)
+	settings.RepoFolderPath = "conf"
+
+	files, err := testGitea(t, settings).GetFilesFromFolderRecursive(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []RepoFile{
+		{ID: "c3", Name: "wg0.conf", Type: "blob", Path: "conf/wg0.conf", Mode: "100644"},
+		{ID: "d4", Name: "wg1.conf", Type: "blob", Path: "conf/wg1.conf", Mode: "120000"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %+v, want %+v", files, want)
+	}
+}
+
+func TestGitea_GetFile(t *testing.T) {
+	server := giteaServer(t)
+	settings := giteaSettings(server)
+	settings.RepoFilePath = "conf/wg0.conf"
+
+	metadata, err := testGitea(t, settings).GetFileMetadata(context.Background(), settings)
+	if err != nil || metadata != (FileMetadata{BlobID: "c3"}) {
+		t.Errorf("GetFileMetadata() = %+v, %v", metadata, err)
+	}
+
+	body, err := testGitea(t, settings).GetFileRaw(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("GetFileRaw() error = %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil || string(data) != "[Interface]\n" {
+		t.Errorf("GetFileRaw() = %q, %v", data, err)
+	}
+}
+
+func TestGitea_GetProject(t *testing.T) {
+	server := giteaServer(t)
+	settings := giteaSettings(server)
+
+	project, err := testGitea(t, settings).GetProject(context.Background(), settings)
+	if err != nil || project != (Project{ID: "infra/wireguard", PathWithNamespace: "infra/wireguard"}) {
+		t.Errorf("GetProject() = %+v, %v", project, err)
+	}
+}
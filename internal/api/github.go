@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// Media types of the GitHub REST API, the raw one returns the content of files and blobs as it is
+const (
+	gitHubJson = "application/vnd.github+json"
+	gitHubRaw  = "application/vnd.github.raw+json"
+)
+
+// GitHub is the Provider for the REST API of github.com (https://api.github.com/) and GitHub Enterprise
+// Server (https://host/api/v3/). The project is owner/repo.
+type GitHub struct {
+	*Client
+}
+
+func (g *GitHub) repoUrl(settings internal.Settings) string {
+	return fmt.Sprintf("%vrepos/%v", settings.ApiUrl, settings.RepoPathEscaped())
+}
+
+func (g *GitHub) GetBranches(ctx context.Context, settings internal.Settings) ([]Branch, error) {
+	apiUrl := fmt.Sprintf("%v/branches?per_page=%v", g.repoUrl(settings), perPage)
+	return getAllPages[Branch](withAccept(ctx, gitHubJson), g.Client, apiUrl, settings)
+}
+
+// ResolveRef returns whether settings.Ref is a branch, tag or commit, like GitLab.ResolveRef does
+func (g *GitHub) ResolveRef(ctx context.Context, settings internal.Settings) (string, error) {
+	ref := url.PathEscape(settings.Ref)
+	return resolveRef(withAccept(ctx, gitHubJson), g.Client, settings, []refUrl{
+		{kind: RefBranch, url: fmt.Sprintf("%v/branches/%v", g.repoUrl(settings), ref)},
+		{kind: RefTag, url: fmt.Sprintf("%v/git/ref/tags/%v", g.repoUrl(settings), ref)},
+		{kind: RefCommit, url: fmt.Sprintf("%v/commits/%v", g.repoUrl(settings), ref)},
+	})
+}
+
+// GetProject returns the repository settings.ProjectNumber, the ID is owner/repo because the API has no
+// repository paths with the numeric ID
+func (g *GitHub) GetProject(ctx context.Context, settings internal.Settings) (Project, error) {
+	body, _, err := g.get(withAccept(ctx, gitHubJson), g.repoUrl(settings), settings)
+	if err != nil {
+		return Project{}, err
+	}
+
+	var repo repository
+	if err := json.Unmarshal(body, &repo); err != nil {
+		return Project{}, err
+	}
+	return Project{ID: repo.FullName, PathWithNamespace: repo.FullName}, nil
+}
+
+// GetFilesFromFolderRecursive lists all files and folders below settings.RepoFolderPath. The trees API
+// returns the whole repository in one response, which is filtered by the folder.
+func (g *GitHub) GetFilesFromFolderRecursive(ctx context.Context, settings internal.Settings) ([]RepoFile, error) {
+	apiUrl := fmt.Sprintf("%v/git/trees/%v?recursive=1", g.repoUrl(settings), url.PathEscape(settings.Ref))
+	body, _, err := g.get(withAccept(ctx, gitHubJson), apiUrl, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree gitTree
+	if err := json.Unmarshal(body, &tree); err != nil {
+		return nil, err
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("tree of %v is truncated, the repository has too many files for the trees API", settings.Ref)
+	}
+
+	return folderFiles(tree.Tree, settings)
+}
+
+// GetFileMetadata returns the blob ID of settings.RepoFilePath, GitHub has no SHA-256 of the content. In
+// folder mode the blob ID is known from the tree, otherwise the contents API is asked.
+func (g *GitHub) GetFileMetadata(ctx context.Context, settings internal.Settings) (FileMetadata, error) {
+	if settings.RepoFileID != "" {
+		return FileMetadata{BlobID: settings.RepoFileID}, nil
+	}
+
+	body, _, err := g.get(withAccept(ctx, gitHubJson), g.contentsUrl(settings), settings)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	return contentsMetadata(body, settings)
+}
+
+// GetFileRaw opens the content of settings.RepoFilePath. With the blob ID from the tree the git blobs API
+// is used, which returns a symlink as its target like GitLab does. Otherwise the contents API is used.
+// The caller must close it.
+func (g *GitHub) GetFileRaw(ctx context.Context, settings internal.Settings) (io.ReadCloser, error) {
+	apiUrl := g.contentsUrl(settings)
+	if settings.RepoFileID != "" {
+		apiUrl = fmt.Sprintf("%v/git/blobs/%v", g.repoUrl(settings), url.PathEscape(settings.RepoFileID))
+	}
+	body, _, err := g.stream(withAccept(ctx, gitHubRaw), apiUrl, settings)
+	return body, err
+}
+
+func (g *GitHub) contentsUrl(settings internal.Settings) string {
+	return fmt.Sprintf("%v/contents/%v?ref=%v", g.repoUrl(settings), escapePath(settings.RepoFilePath), url.QueryEscape(settings.Ref))
+}
+
+// GetLFSObject opens the content of pointer from the Git LFS API of the repository
+func (g *GitHub) GetLFSObject(ctx context.Context, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error) {
+	return getLFSObject(ctx, g.Client, settings, pointer)
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// gitHubServer serves a repository infra/wireguard with the branch main like the GitHub REST API
+func gitHubServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	json := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept") != gitHubJson {
+				t.Errorf("Accept = %q, want %q", r.Header.Get("Accept"), gitHubJson)
+			}
+			if r.Header.Get("Authorization") != "Bearer token" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			w.Write([]byte(body))
+		}
+	}
+	raw := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept") != gitHubRaw {
+				t.Errorf("Accept = %q, want %q", r.Header.Get("Accept"), gitHubRaw)
+			}
+			w.Write([]byte(body))
+		}
+	}
+
+	mux.HandleFunc("GET /api/v3/repos/infra/wireguard", json(`{"id": 42, "full_name": "infra/wireguard"}`))
+	mux.HandleFunc("GET /api/v3/repos/infra/wireguard/branches/main", json(`{"name": "main"}`))
+	mux.HandleFunc("GET /api/v3/repos/infra/wireguard/git/ref/tags/v1.0", json(`{"ref": "refs/tags/v1.0"}`))
+	mux.HandleFunc("GET /api/v3/repos/infra/wireguard/git/trees/main", json(`{"sha": "9fb037", "truncated": false, "tree": [
+		{"path": "README.md", "mode": "100644", "type": "blob", "sha": "a1"},
+		{"path": "conf", "mode": "040000", "type": "tree", "sha": "b2"},
+		{"path": "conf/wg0.conf", "mode": "100644", "type": "blob", "sha": "c3"},
+		{"path": "conf/up.sh", "mode": "100755", "type": "blob", "sha": "d4"},
+		{"path": "config", "mode": "100644", "type": "blob", "sha": "e5"}
+	]}`))
+	mux.HandleFunc("GET /api/v3/repos/infra/wireguard/contents/conf/wg0.conf", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "main" {
+			t.Errorf("ref = %q, want main", r.URL.Query().Get("ref"))
+		}
+		if r.Header.Get("Accept") == gitHubRaw {
+			raw("[Interface]\n")(w, r)
+			return
+		}
+		json(`{"type": "file", "sha": "c3", "content": "W0ludGVyZmFjZV0K"}`)(w, r)
+	})
+	mux.HandleFunc("GET /api/v3/repos/infra/wireguard/git/blobs/c3", raw("[Interface]\n"))
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	HttpGetFunc = httpGetInternal
+	HttpStreamFunc = httpStreamInternal
+	return server
+}
+
+func testGitHub(t *testing.T, settings internal.Settings) *GitHub {
+	return &GitHub{Client: testClient(t, settings)}
+}
+
+func TestGitHub_ResolveRef(t *testing.T) {
+	server := gitHubServer(t)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{ref: "main", want: RefBranch},
+		{ref: "v1.0", want: RefTag},
+		{ref: "missing", wantErr: ErrRefNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			settings := internal.Settings{Provider: internal.ProviderGitHub, ApiUrl: server.URL + "/api/v3/", ProjectNumber: "infra/wireguard", PrivateToken: "token", Ref: tt.ref}
+			got, err := testGitHub(t, settings).ResolveRef(context.Background(), settings)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveRef() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveRef() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHub_GetFilesFromFolderRecursive(t *testing.T) {
+	server := gitHubServer(t)
+	settings := internal.Settings{Provider: internal.ProviderGitHub, ApiUrl: server.URL + "/api/v3/", ProjectNumber: "infra%2Fwireguard", PrivateToken: "token", Ref: "main", RepoFolderPath: "conf"}
+
+	files, err := testGitHub(t, settings).GetFilesFromFolderRecursive(context.Background(), settings)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []RepoFile{
+		{ID: "c3", Name: "wg0.conf", Type: "blob", Path: "conf/wg0.conf", Mode: "100644"},
+		{ID: "d4", Name: "up.sh", Type: "blob", Path: "conf/up.sh", Mode: "100755"},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %+v, want %+v", files, want)
+	}
+
+	settings.RepoFolderPath = "missing"
+	if _, err := testGitHub(t, settings).GetFilesFromFolderRecursive(context.Background(), settings); err == nil {
+		t.Error("expected error for a missing folder, got nil")
+	}
+}
+
+func TestGitHub_GetFile(t *testing.T) {
+	server := gitHubServer(t)
+	settings := internal.Settings{Provider: internal.ProviderGitHub, ApiUrl: server.URL + "/api/v3/", ProjectNumber: "infra/wireguard", PrivateToken: "token", Ref: "main", RepoFilePath: "conf/wg0.conf"}
+
+	// File mode uses the contents API, folder mode the blob ID of the tree
+	for _, blobID := range []string{"", "c3"} {
+		settings.RepoFileID = blobID
+
+		metadata, err := testGitHub(t, settings).GetFileMetadata(context.Background(), settings)
+		if err != nil || metadata != (FileMetadata{BlobID: "c3"}) {
+			t.Errorf("GetFileMetadata() = %+v, %v", metadata, err)
+		}
+
+		body, err := testGitHub(t, settings).GetFileRaw(context.Background(), settings)
+		if err != nil {
+			t.Fatalf("GetFileRaw() error = %v", err)
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil || string(data) != "[Interface]\n" {
+			t.Errorf("GetFileRaw() = %q, %v", data, err)
+		}
+	}
+}
+
+func TestGitHub_GetProject(t *testing.T) {
+	server := gitHubServer(t)
+	settings := internal.Settings{Provider: internal.ProviderGitHub, ApiUrl: server.URL + "/api/v3/", ProjectNumber: "infra/wireguard", PrivateToken: "token"}
+
+	project, err := testGitHub(t, settings).GetProject(context.Background(), settings)
+	if err != nil || project != (Project{ID: "infra/wireguard", PathWithNamespace: "infra/wireguard"}) {
+		t.Errorf("GetProject() = %+v, %v", project, err)
+	}
+}
+
+func TestFileMetadata_Matches(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  FileMetadata
+		match bool
+	}{
+		{name: "Same SHA-256", a: FileMetadata{ContentSha256: "11c0", BlobID: "1e85"}, b: FileMetadata{ContentSha256: "11c0", BlobID: "ffff"}, match: true},
+		{name: "Other SHA-256", a: FileMetadata{ContentSha256: "11c0", BlobID: "1e85"}, b: FileMetadata{ContentSha256: "abcd", BlobID: "1e85"}, match: false},
+		{name: "Same blob ID", a: FileMetadata{ContentSha256: "11c0", BlobID: "1e85"}, b: FileMetadata{BlobID: "1e85"}, match: true},
+		{name: "Nothing to compare", a: FileMetadata{ContentSha256: "11c0"}, b: FileMetadata{BlobID: "1e85"}, match: false},
+		{name: "Empty", a: FileMetadata{}, b: FileMetadata{}, match: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Matches(tt.b); got != tt.match {
+				t.Errorf("FileMetadata.Matches() = %v, want %v", got, tt.match)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// GitLab is the Provider for the API v4 of gitlab.com and self-managed GitLab instances
+type GitLab struct {
+	*Client
+}
+
+func (g *GitLab) GetBranches(ctx context.Context, settings internal.Settings) ([]Branch, error) {
+	apiUrl := fmt.Sprintf("%vprojects/%v/repository/branches?per_page=%v", settings.ApiUrl, settings.ProjectPathEscaped(), perPage)
+	return getAllPages[Branch](ctx, g.Client, apiUrl, settings)
+}
+
+// ResolveRef returns whether settings.Ref is a branch, tag or commit. Only the single ref is requested
+// from the branches, tags and commits endpoints, in this order, not the list of all branches.
+func (g *GitLab) ResolveRef(ctx context.Context, settings internal.Settings) (string, error) {
+	ref := url.PathEscape(settings.Ref)
+	var refUrls []refUrl
+	for _, kind := range []struct{ name, endpoint string }{{RefBranch, "branches"}, {RefTag, "tags"}, {RefCommit, "commits"}} {
+		apiUrl := fmt.Sprintf("%vprojects/%v/repository/%v/%v", settings.ApiUrl, settings.ProjectPathEscaped(), kind.endpoint, ref)
+		refUrls = append(refUrls, refUrl{kind: kind.name, url: apiUrl})
+	}
+	return resolveRef(ctx, g.Client, settings, refUrls)
+}
+
+// GetProject returns the project settings.ProjectNumber, which can be the ID or the namespace path
+func (g *GitLab) GetProject(ctx context.Context, settings internal.Settings) (Project, error) {
+	apiUrl := fmt.Sprintf("%vprojects/%v", settings.ApiUrl, settings.ProjectPathEscaped())
+	body, _, err := g.get(ctx, apiUrl, settings)
+	if err != nil {
+		return Project{}, err
+	}
+
+	var project GitLabProject
+	if err := json.Unmarshal(body, &project); err != nil {
+		return Project{}, err
+	}
+	return Project{ID: strconv.Itoa(project.ID), PathWithNamespace: project.PathWithNamespace}, nil
+}
+
+// GetLFSObject opens the content of pointer from the Git LFS API of the project, which is below the
+// namespace path. A project ID is looked up first.
+func (g *GitLab) GetLFSObject(ctx context.Context, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error) {
+	if _, err := strconv.Atoi(settings.ProjectNumber); err == nil {
+		project, err := g.GetProject(ctx, settings)
+		if err != nil {
+			return nil, err
+		}
+		settings.ProjectNumber = project.PathWithNamespace
+	}
+	return getLFSObject(ctx, g.Client, settings, pointer)
+}
+
+type GitLabProject struct {
+	ID                int    `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+}
+
+// GetFilesFromFolderRecursive lists all files and folders below settings.RepoFolderPath as a flat list,
+// without one request per sub folder
+func (g *GitLab) GetFilesFromFolderRecursive(ctx context.Context, settings internal.Settings) ([]RepoFile, error) {
+	path := url.QueryEscape(settings.RepoFolderPath)
+	ref := url.QueryEscape(settings.Ref)
+	apiUrl := fmt.Sprintf("%vprojects/%v/repository/tree/?ref=%v&path=%v&recursive=true&per_page=%v", settings.ApiUrl, settings.ProjectPathEscaped(), ref, path, perPage)
+	return getAllPages[RepoFile](ctx, g.Client, apiUrl, settings)
+}
+
+func (g *GitLab) GetFile(ctx context.Context, settings internal.Settings) (GitLapFile, error) {
+	path := url.QueryEscape(settings.RepoFilePath)
+	ref := url.QueryEscape(settings.Ref)
+	apiUrl := fmt.Sprintf("%vprojects/%v/repository/files/%v?ref=%v", settings.ApiUrl, settings.ProjectPathEscaped(), path, ref)
+
+	body, _, err := g.get(ctx, apiUrl, settings)
+	if err != nil {
+		return GitLapFile{}, err
+	}
+
+	file, err := createGitLapFile(body)
+	if err != nil {
+		return GitLapFile{}, err
+	}
+	return file, nil
+}
+
+// GetFileMetadata returns the metadata of settings.RepoFilePath from the headers of a HEAD request, the
+// content isn't downloaded. In folder mode the blob ID is known from the tree, so no request is needed.
+func (g *GitLab) GetFileMetadata(ctx context.Context, settings internal.Settings) (FileMetadata, error) {
+	if settings.RepoFileID != "" {
+		return FileMetadata{BlobID: settings.RepoFileID}, nil
+	}
+
+	path := url.PathEscape(settings.RepoFilePath)
+	ref := url.QueryEscape(settings.Ref)
+	apiUrl := fmt.Sprintf("%vprojects/%v/repository/files/%v?ref=%v", settings.ApiUrl, settings.ProjectPathEscaped(), path, ref)
+
+	header, err := g.head(ctx, apiUrl, settings)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+
+	metadata := FileMetadata{
+		ContentSha256: header.Get("X-Gitlab-Content-Sha256"),
+		BlobID:        header.Get("X-Gitlab-Blob-Id"),
+	}
+	if metadata.ContentSha256 == "" {
+		return FileMetadata{}, errors.New("response has no X-Gitlab-Content-Sha256 header")
+	}
+	return metadata, nil
+}
+
+// GetFileRaw opens the content of settings.RepoFilePath for streaming, without the base64 encoding and
+// the size limit of GetFile. The caller must close it. If the raw endpoint fails, e.g. because a proxy
+// blocks it, the content of GetFile is returned.
+func (g *GitLab) GetFileRaw(ctx context.Context, settings internal.Settings) (io.ReadCloser, error) {
+	path := url.PathEscape(settings.RepoFilePath)
+	ref := url.QueryEscape(settings.Ref)
+	apiUrl := fmt.Sprintf("%vprojects/%v/repository/files/%v/raw?ref=%v", settings.ApiUrl, settings.ProjectPathEscaped(), path, ref)
+
+	body, _, err := g.stream(ctx, apiUrl, settings)
+	if err == nil || !needsJsonFallback(err) {
+		return body, err
+	}
+
+	log.Println("Raw download of", settings.RepoFilePath, "failed, fall back to the JSON API:", err)
+	gitLapFile, err := g.GetFile(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(gitLapFile.Content)
+	if err != nil {
+		return nil, fmt.Errorf("DecodeString: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if gitLapFile.ContentSha256 != "" && hex.EncodeToString(sum[:]) != gitLapFile.ContentSha256 {
+		return nil, fmt.Errorf("content doesn't match content_sha256 %v", gitLapFile.ContentSha256)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// needsJsonFallback returns whether the JSON API can succeed where the raw endpoint failed with err.
+// Missing access, a missing file and rate limits fail the same way.
+func needsJsonFallback(err error) bool {
+	var httpErr *HttpError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	switch httpErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests:
+		return false
+	}
+	return true
+}
+
+func createGitLapFile(data []byte) (GitLapFile, error) {
+	var gitLapFile GitLapFile
+	err := json.Unmarshal(data, &gitLapFile)
+	return gitLapFile, err
+}
+
+type GitLapFile struct {
+	FileName      string `json:"file_name"`
+	ContentSha256 string `json:"content_sha256"`
+	Content       string
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+const (
+	// lfsPointerVersion is the first line of a Git LFS pointer file
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1\n"
+	// lfsPointerMaxSize is the size up to which git-lfs checks a file for a pointer
+	lfsPointerMaxSize = 1024
+	lfsMediaType      = "application/vnd.git-lfs+json"
+)
+
+var lfsOidPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ErrLFSObjectNotFound is returned if a local repository doesn't have the content of a pointer
+var ErrLFSObjectNotFound = errors.New("LFS object not found")
+
+// LFSPointer is a file tracked by Git LFS, the repository has this pointer instead of the content
+type LFSPointer struct {
+	// Oid is the SHA-256 of the content
+	Oid  string
+	Size int64
+}
+
+// ParseLFSPointer returns the pointer if data is a Git LFS pointer file
+func ParseLFSPointer(data []byte) (LFSPointer, bool) {
+	if len(data) >= lfsPointerMaxSize || !bytes.HasPrefix(data, []byte(lfsPointerVersion)) {
+		return LFSPointer{}, false
+	}
+
+	var pointer LFSPointer
+	var hasSize bool
+	for _, line := range strings.Split(strings.TrimSuffix(string(data[len(lfsPointerVersion):]), "\n"), "\n") {
+		key, value, found := strings.Cut(line, " ")
+		if !found {
+			return LFSPointer{}, false
+		}
+		switch key {
+		case "oid":
+			oid, found := strings.CutPrefix(value, "sha256:")
+			if !found || !lfsOidPattern.MatchString(oid) {
+				return LFSPointer{}, false
+			}
+			pointer.Oid = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return LFSPointer{}, false
+			}
+			pointer.Size, hasSize = size, true
+		}
+	}
+	return pointer, pointer.Oid != "" && hasSize
+}
+
+// OpenFile opens the content of settings.RepoFilePath like GetFileRaw. If the file is a Git LFS pointer,
+// the pointer is returned instead, its content is opened with OpenLFSObject. The caller must close it.
+func OpenFile(ctx context.Context, provider Provider, settings internal.Settings) (io.ReadCloser, *LFSPointer, error) {
+	body, err := provider.GetFileRaw(ctx, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReaderSize(body, lfsPointerMaxSize)
+	start, err := reader.Peek(lfsPointerMaxSize)
+	if err != nil && err != io.EOF {
+		body.Close()
+		return nil, nil, err
+	}
+	if pointer, ok := ParseLFSPointer(start); ok {
+		body.Close()
+		return nil, &pointer, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, body}, nil, nil
+}
+
+// OpenLFSObject opens the content of pointer, the SHA-256 and the size are checked while it is read. The
+// caller must close it.
+func OpenLFSObject(ctx context.Context, provider Provider, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error) {
+	body, err := provider.GetLFSObject(ctx, settings, pointer)
+	if err != nil {
+		return nil, err
+	}
+	return &lfsVerifier{ReadCloser: body, pointer: pointer, hash: sha256.New()}, nil
+}
+
+// lfsVerifier returns an error at the end of the content, if it doesn't match the pointer
+type lfsVerifier struct {
+	io.ReadCloser
+	pointer LFSPointer
+	hash    hash.Hash
+	size    int64
+}
+
+func (v *lfsVerifier) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.hash.Write(p[:n])
+	v.size += int64(n)
+	if v.size > v.pointer.Size {
+		return n, fmt.Errorf("LFS object %v is larger than %v bytes", v.pointer.Oid, v.pointer.Size)
+	}
+	if err == io.EOF {
+		if v.size != v.pointer.Size {
+			return n, fmt.Errorf("LFS object %v has %v bytes, want %v", v.pointer.Oid, v.size, v.pointer.Size)
+		}
+		if sum := hex.EncodeToString(v.hash.Sum(nil)); sum != v.pointer.Oid {
+			return n, fmt.Errorf("LFS object %v has the SHA-256 %v", v.pointer.Oid, sum)
+		}
+	}
+	return n, err
+}
+
+// getLFSObject requests the download of pointer from the Git LFS batch API of the repository and streams
+// the object. The token is sent like git sends it, the object is often on another host which gets only
+// the headers of the batch response.
+func getLFSObject(ctx context.Context, c *Client, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error) {
+	lfsUrl := settings.LFSUrl()
+	batch, err := json.Marshal(lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   []lfsObject{{Oid: pointer.Oid, Size: pointer.Size}},
+		HashAlgo:  "sha256",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body, _, err := c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, lfsUrl+"/objects/batch", bytes.NewReader(batch))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", lfsMediaType)
+		req.Header.Set("Content-Type", lfsMediaType)
+		req.Header.Set("User-Agent", settings.UserAgent)
+		if settings.PrivateToken != "" {
+			setGitAuth(req, settings)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LFS batch request to %v: %w", lfsUrl, err)
+	}
+	defer body.Close()
+
+	var response struct {
+		Objects []struct {
+			Oid     string `json:"oid"`
+			Actions struct {
+				Download *struct {
+					Href   string            `json:"href"`
+					Header map[string]string `json:"header"`
+				} `json:"download"`
+			} `json:"actions"`
+			Error *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("LFS batch response of %v: %w", lfsUrl, err)
+	}
+	if len(response.Objects) != 1 || response.Objects[0].Oid != pointer.Oid {
+		return nil, fmt.Errorf("LFS batch response of %v has no object %v", lfsUrl, pointer.Oid)
+	}
+	object := response.Objects[0]
+	if object.Error != nil {
+		return nil, fmt.Errorf("LFS object %v: %v %v", pointer.Oid, object.Error.Code, object.Error.Message)
+	}
+	if object.Actions.Download == nil {
+		return nil, fmt.Errorf("LFS object %v has no download", pointer.Oid)
+	}
+
+	download := object.Actions.Download
+	href, err := url.Parse(download.Href)
+	if err != nil {
+		return nil, fmt.Errorf("LFS object %v: %w", pointer.Oid, err)
+	}
+	// Only the LFS server itself gets the token, not a storage like S3 which has its own in the href
+	lfs, _ := url.Parse(lfsUrl)
+	sameHost := lfs != nil && strings.EqualFold(href.Host, lfs.Host)
+
+	stream, _, err := c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, href.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range download.Header {
+			req.Header.Set(name, value)
+		}
+		req.Header.Set("User-Agent", settings.UserAgent)
+		if sameHost && settings.PrivateToken != "" && req.Header.Get("Authorization") == "" {
+			setGitAuth(req, settings)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LFS object %v: %w", pointer.Oid, err)
+	}
+	return stream, nil
+}
+
+type lfsBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers"`
+	Objects   []lfsObject `json:"objects"`
+	HashAlgo  string      `json:"hash_algo"`
+}
+
+type lfsObject struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lfsPointer(content string) (string, LFSPointer) {
+	sum := sha256.Sum256([]byte(content))
+	pointer := LFSPointer{Oid: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+	return fmt.Sprintf("%void sha256:%v\nsize %v\n", lfsPointerVersion, pointer.Oid, pointer.Size), pointer
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	file, want := lfsPointer("firmware")
+	tests := []struct {
+		name   string
+		data   string
+		wantOk bool
+	}{
+		{name: "Pointer", data: file, wantOk: true},
+		{name: "Extension", data: strings.Replace(file, "oid", "ext-0-foo sha256:"+want.Oid+"\noid", 1), wantOk: true},
+		{name: "Without newline", data: strings.TrimSuffix(file, "\n"), wantOk: true},
+		{name: "File", data: "[Interface]\n"},
+		{name: "Empty", data: ""},
+		{name: "Without size", data: lfsPointerVersion + "oid sha256:" + want.Oid + "\n"},
+		{name: "Other hash", data: lfsPointerVersion + "oid md5:0cc175b9c0f1b6a831c399e269772661\nsize 1\n"},
+		{name: "Too large", data: file + strings.Repeat("x", lfsPointerMaxSize)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseLFSPointer([]byte(tt.data))
+			if ok != tt.wantOk {
+				t.Fatalf("ParseLFSPointer() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && got != want {
+				t.Errorf("ParseLFSPointer() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// lfsServer serves the repository infra/wireguard like Gitea with the files certs/ca.pem, which is a Git
+// LFS pointer, certs/bad.pem, whose object doesn't match its pointer, and the regular file conf/wg0.conf
+func lfsServer(t *testing.T) *httptest.Server {
+	objects := map[string]string{}
+	files := map[string]string{"conf/wg0.conf": "[Interface]\n"}
+	for name, content := range map[string]string{"certs/ca.pem": "-----BEGIN CERTIFICATE-----\n", "certs/bad.pem": "-----BEGIN"} {
+		file, pointer := lfsPointer(content)
+		files[name] = file
+		objects[pointer.Oid] = content
+		if name == "certs/bad.pem" {
+			objects[pointer.Oid] = "-----BEGIX"
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/repos/infra/wireguard/raw/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(files[r.PathValue("path")]))
+	})
+	mux.HandleFunc("POST /infra/wireguard.git/info/lfs/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "oauth2" || password != "token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Content-Type") != lfsMediaType {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		var batch lfsBatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil || batch.Operation != "download" || len(batch.Objects) != 1 {
+			t.Errorf("batch = %+v, %v", batch, err)
+			return
+		}
+		oid := batch.Objects[0].Oid
+		w.Header().Set("Content-Type", lfsMediaType)
+		if _, ok := objects[oid]; !ok {
+			fmt.Fprintf(w, `{"objects": [{"oid": %q, "error": {"code": 404, "message": "Object does not exist"}}]}`, oid)
+			return
+		}
+		fmt.Fprintf(w, `{"transfer": "basic", "objects": [{"oid": %q, "size": %v, "actions": {"download": {
+			"href": "http://%v/lfs/objects/%v", "header": {"X-Download": "1"}}}}]}`, oid, batch.Objects[0].Size, r.Host, oid)
+	})
+	mux.HandleFunc("GET /lfs/objects/{oid}", func(w http.ResponseWriter, r *http.Request) {
+		if _, password, _ := r.BasicAuth(); password != "token" || r.Header.Get("X-Download") != "1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(objects[r.PathValue("oid")]))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	HttpStreamFunc = httpStreamInternal
+	HttpDoFunc = httpDoInternal
+	return server
+}
+
+func TestOpenFile_LFS(t *testing.T) {
+	server := lfsServer(t)
+	settings := giteaSettings(server)
+
+	tests := []struct {
+		path    string
+		want    string
+		wantLFS bool
+		wantErr bool
+	}{
+		{path: "conf/wg0.conf", want: "[Interface]\n"},
+		{path: "certs/ca.pem", want: "-----BEGIN CERTIFICATE-----\n", wantLFS: true},
+		{path: "certs/bad.pem", wantLFS: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			settings.RepoFilePath = tt.path
+			gitea := testGitea(t, settings)
+			body, pointer, err := OpenFile(context.Background(), gitea, settings)
+			if err != nil {
+				t.Fatalf("OpenFile() error = %v", err)
+			}
+			if (pointer != nil) != tt.wantLFS {
+				t.Fatalf("OpenFile() pointer = %+v, want LFS %v", pointer, tt.wantLFS)
+			}
+			if pointer != nil {
+				if body, err = OpenLFSObject(context.Background(), gitea, settings, *pointer); err != nil {
+					t.Fatalf("OpenLFSObject() error = %v", err)
+				}
+			}
+			defer body.Close()
+			data, err := io.ReadAll(body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("read error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(data) != tt.want {
+				t.Errorf("content = %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	_, missing := lfsPointer("missing")
+	if _, err := OpenLFSObject(context.Background(), testGitea(t, settings), settings, missing); err == nil || !strings.Contains(err.Error(), "Object does not exist") {
+		t.Errorf("OpenLFSObject() of a missing object error = %v", err)
+	}
+
+	settings.PrivateToken = "wrong"
+	_, pointer := lfsPointer("-----BEGIN CERTIFICATE-----\n")
+	var httpErr *HttpError
+	if _, err := OpenLFSObject(context.Background(), testGitea(t, settings), settings, pointer); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("OpenLFSObject() with a wrong token error = %v, want 401", err)
+	}
+}
+
+func TestGit_GetLFSObject(t *testing.T) {
+	folder := gitRepo(t)
+	repo := filepath.Join(folder, "config.git")
+	settings := gitSettings(folder)
+	content := "firmware\n"
+	_, pointer := lfsPointer(content)
+
+	if _, err := (&Git{}).GetLFSObject(context.Background(), settings, pointer); !errors.Is(err, ErrLFSObjectNotFound) {
+		t.Fatalf("GetLFSObject() error = %v, want %v", err, ErrLFSObjectNotFound)
+	}
+
+	objectDir := filepath.Join(repo, "lfs", "objects", pointer.Oid[0:2], pointer.Oid[2:4])
+	if err := os.MkdirAll(objectDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(objectDir, pointer.Oid), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	body, err := OpenLFSObject(context.Background(), &Git{}, settings, pointer)
+	if err != nil {
+		t.Fatalf("OpenLFSObject() error = %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil || string(data) != content {
+		t.Errorf("OpenLFSObject() = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// Provider is a git hosting service with the project, every method reads the project, ref and path
+// from the settings
+type Provider interface {
+	// ResolveRef returns whether settings.Ref is a RefBranch, RefTag or RefCommit, or ErrRefNotFound
+	ResolveRef(ctx context.Context, settings internal.Settings) (string, error)
+	// GetBranches lists the branches, as hint for a wrong ref
+	GetBranches(ctx context.Context, settings internal.Settings) ([]Branch, error)
+	// GetFilesFromFolderRecursive lists all files and folders below settings.RepoFolderPath as a flat
+	// list with paths relative to the root of the repository
+	GetFilesFromFolderRecursive(ctx context.Context, settings internal.Settings) ([]RepoFile, error)
+	// GetFileRaw opens the content of settings.RepoFilePath for streaming, the caller must close it
+	GetFileRaw(ctx context.Context, settings internal.Settings) (io.ReadCloser, error)
+	// GetFileMetadata returns the hashes of settings.RepoFilePath without downloading the content
+	GetFileMetadata(ctx context.Context, settings internal.Settings) (FileMetadata, error)
+	// GetProject returns the project settings.ProjectNumber, for submodules
+	GetProject(ctx context.Context, settings internal.Settings) (Project, error)
+	// GetLFSObject opens the content of a Git LFS pointer, use OpenLFSObject to verify it. The caller must
+	// close it.
+	GetLFSObject(ctx context.Context, settings internal.Settings, pointer LFSPointer) (io.ReadCloser, error)
+}
+
+// NewProvider creates the Provider of settings.Provider with a Client for the settings
+func NewProvider(settings internal.Settings) (Provider, error) {
+	client, err := NewClient(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	switch settings.Provider {
+	case "", internal.ProviderGitLab:
+		return &GitLab{Client: client}, nil
+	case internal.ProviderGitHub:
+		return &GitHub{Client: client}, nil
+	case internal.ProviderGitea:
+		return &Gitea{Client: client}, nil
+	case internal.ProviderBitbucket:
+		return &Bitbucket{Client: client}, nil
+	case internal.ProviderAzure:
+		return &Azure{Client: client}, nil
+	case internal.ProviderGit:
+		return &Git{Client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown provider %v", settings.Provider)
+}
+
+// ReadFile returns the content of settings.RepoFilePath, for small files like symlinks and .gitmodules
+func ReadFile(ctx context.Context, provider Provider, settings internal.Settings) ([]byte, error) {
+	body, err := provider.GetFileRaw(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// HttpError is returned if the server responds with an unexpected status code
+type HttpError struct {
+	// Method of the request, empty means GET like in http.Request
+	Method     string
+	StatusCode int
+	Header     http.Header
+}
+
+func (e *HttpError) Error() string {
+	method := e.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return fmt.Sprintf("HTTP %v failed with status code %v", method, e.StatusCode)
+}
+
+// retryPolicy defines how often and how long to wait before a failed request is repeated
+type retryPolicy struct {
+	// retries is the number of retries after the first attempt
+	retries int
+	// wait is the delay before the first retry, it doubles with every further retry
+	wait time.Duration
+	// maxWait limits the delay, a server asking to wait longer ends the retries
+	maxWait time.Duration
+}
+
+// get calls HttpGetFunc and retries on network errors, 429 and 5xx responses
+func (c *Client) get(ctx context.Context, apiUrl string, settings internal.Settings) ([]byte, http.Header, error) {
+	return withRetry(ctx, c.retry, func() ([]byte, http.Header, error) {
+		return HttpGetFunc(ctx, c.httpClient, apiUrl, settings)
+	})
+}
+
+// stream calls HttpStreamFunc and retries like get. Only opening the body is retried, not reading it.
+func (c *Client) stream(ctx context.Context, apiUrl string, settings internal.Settings) (io.ReadCloser, http.Header, error) {
+	return withRetry(ctx, c.retry, func() (io.ReadCloser, http.Header, error) {
+		return HttpStreamFunc(ctx, c.httpClient, apiUrl, settings)
+	})
+}
+
+// do sends the request of newRequest with HttpDoFunc and retries like get, every attempt gets a new request
+func (c *Client) do(ctx context.Context, newRequest func() (*http.Request, error)) (io.ReadCloser, http.Header, error) {
+	return withRetry(ctx, c.retry, func() (io.ReadCloser, http.Header, error) {
+		req, err := newRequest()
+		if err != nil {
+			return nil, nil, err
+		}
+		return HttpDoFunc(c.httpClient, req)
+	})
+}
+
+// head calls HttpHeadFunc and retries like get
+func (c *Client) head(ctx context.Context, apiUrl string, settings internal.Settings) (http.Header, error) {
+	header, _, err := withRetry(ctx, c.retry, func() (http.Header, http.Header, error) {
+		header, err := HttpHeadFunc(ctx, c.httpClient, apiUrl, settings)
+		return header, header, err
+	})
+	return header, err
+}
+
+// withRetry calls request until it succeeds, fails with an error which isn't retryable or the retries of
+// policy are used up
+func withRetry[T any](ctx context.Context, policy retryPolicy, request func() (T, http.Header, error)) (T, http.Header, error) {
+	for attempt := 0; ; attempt++ {
+		body, header, err := request()
+		if err == nil || attempt >= policy.retries || !isRetryable(ctx, err) {
+			return body, header, err
+		}
+
+		var none T
+		wait, ok := policy.delay(attempt, err, time.Now())
+		if !ok {
+			return none, nil, fmt.Errorf("%w, server asks to wait %v which is longer than the maximum wait %v", err, wait, policy.maxWait)
+		}
+
+		log.Println("Retry", attempt+1, "of", policy.retries, "in", wait.Round(time.Millisecond), "because:", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return none, nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryable returns whether a request which failed with err can succeed on a retry
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	// Other errors like a malformed url, an unknown host or an invalid certificate fail again
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// delay returns the wait time before the next retry. The Retry-After and RateLimit-Reset headers take
+// precedence over the exponential backoff, ok is false if they ask for more than maxWait.
+func (p retryPolicy) delay(attempt int, err error, now time.Time) (wait time.Duration, ok bool) {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		if wait, found := serverDelay(httpErr.Header, now); found {
+			return wait, wait <= p.maxWait
+		}
+	}
+
+	if p.wait <= 0 {
+		return 0, true
+	}
+	backoff := p.wait << attempt
+	if backoff > p.maxWait || backoff < p.wait {
+		backoff = p.maxWait
+	}
+
+	// Jitter between half and full backoff, so parallel clients don't retry in lockstep
+	half := backoff / 2
+	return half + rand.N(backoff-half+1), true
+}
+
+// serverDelay reads the wait time from the Retry-After (seconds or HTTP date) or RateLimit-Reset (Unix time) header
+func serverDelay(header http.Header, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return max(time.Duration(seconds)*time.Second, 0), true
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return max(date.Sub(now), 0), true
+		}
+	}
+
+	if reset := header.Get("RateLimit-Reset"); reset != "" {
+		if unix, err := strconv.ParseInt(reset, 10, 64); err == nil {
+			return max(time.Unix(unix, 0).Sub(now), 0), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+func TestClient_get_Retry(t *testing.T) {
+	settings := internal.Settings{
+		Retries:      2,
+		RetryWait:    time.Millisecond,
+		RetryMaxWait: 10 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name      string
+		responses []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "Success after 502 and network error",
+			responses: []error{&HttpError{StatusCode: 502}, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, nil},
+			wantCalls: 3,
+			wantErr:   false,
+		},
+		{
+			name:      "Give up after retries",
+			responses: []error{&HttpError{StatusCode: 503}, &HttpError{StatusCode: 503}, &HttpError{StatusCode: 503}, nil},
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		{
+			name:      "Success after timeout and unexpected EOF",
+			responses: []error{os.ErrDeadlineExceeded, io.ErrUnexpectedEOF, nil},
+			wantCalls: 3,
+			wantErr:   false,
+		},
+		{
+			name:      "No retry on unknown host",
+			responses: []error{&url.Error{Op: "Get", URL: "https://gitlab.invalid", Err: &net.DNSError{Err: "no such host", Name: "gitlab.invalid", IsNotFound: true}}, nil},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "No retry on 404",
+			responses: []error{&HttpError{StatusCode: 404}, nil},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "Retry-After longer than maximum wait",
+			responses: []error{&HttpError{StatusCode: 429, Header: http.Header{"Retry-After": []string{"60"}}}, nil},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "Retry-After within maximum wait",
+			responses: []error{&HttpError{StatusCode: 429, Header: http.Header{"Retry-After": []string{"0"}}}, nil},
+			wantCalls: 2,
+			wantErr:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			HttpGetFunc = func(ctx context.Context, c *http.Client, apiUrl string, s internal.Settings) ([]byte, http.Header, error) {
+				err := tt.responses[calls]
+				calls++
+				if err != nil {
+					return nil, nil, err
+				}
+				return []byte(`[]`), nil, nil
+			}
+
+			_, _, err := testClient(t, settings).get(context.Background(), "https://gitlab.com/api/v4/", settings)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("get() calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClient_get_RetryCanceled(t *testing.T) {
+	settings := internal.Settings{
+		Retries:      5,
+		RetryWait:    time.Hour,
+		RetryMaxWait: time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	HttpGetFunc = func(ctx context.Context, c *http.Client, apiUrl string, s internal.Settings) ([]byte, http.Header, error) {
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return nil, nil, &HttpError{StatusCode: 500}
+	}
+
+	_, _, err := testClient(t, settings).get(ctx, "https://gitlab.com/api/v4/", settings)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("get() error = %v, want context.Canceled", err)
+	}
+}
+
+func Test_retryPolicy_delay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := retryPolicy{retries: 5, wait: time.Second, maxWait: 30 * time.Second}
+
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		wantMin time.Duration
+		wantMax time.Duration
+		wantOk  bool
+	}{
+		{name: "First backoff", attempt: 0, err: errors.New("network"), wantMin: 500 * time.Millisecond, wantMax: time.Second, wantOk: true},
+		{name: "Third backoff", attempt: 2, err: errors.New("network"), wantMin: 2 * time.Second, wantMax: 4 * time.Second, wantOk: true},
+		{name: "Capped backoff", attempt: 40, err: errors.New("network"), wantMin: 15 * time.Second, wantMax: 30 * time.Second, wantOk: true},
+		{
+			name:    "Retry-After seconds",
+			err:     &HttpError{StatusCode: 429, Header: http.Header{"Retry-After": []string{"7"}}},
+			wantMin: 7 * time.Second, wantMax: 7 * time.Second, wantOk: true,
+		},
+		{
+			name:    "Retry-After date",
+			err:     &HttpError{StatusCode: 503, Header: http.Header{"Retry-After": []string{now.Add(20 * time.Second).Format(http.TimeFormat)}}},
+			wantMin: 20 * time.Second, wantMax: 20 * time.Second, wantOk: true,
+		},
+		{
+			name:    "RateLimit-Reset",
+			err:     &HttpError{StatusCode: 429, Header: http.Header{"Ratelimit-Reset": []string{strconv.FormatInt(now.Add(12*time.Second).Unix(), 10)}}},
+			wantMin: 12 * time.Second, wantMax: 12 * time.Second, wantOk: true,
+		},
+		{
+			name:    "RateLimit-Reset too far",
+			err:     &HttpError{StatusCode: 429, Header: http.Header{"Ratelimit-Reset": []string{strconv.FormatInt(now.Add(time.Hour).Unix(), 10)}}},
+			wantMin: time.Hour, wantMax: time.Hour, wantOk: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := policy.delay(tt.attempt, tt.err, now)
+			if ok != tt.wantOk {
+				t.Errorf("delay() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("delay() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestHttpError_Error(t *testing.T) {
+	if got, want := (&HttpError{Method: http.MethodPost, StatusCode: 401}).Error(), "HTTP POST failed with status code 401"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := (&HttpError{StatusCode: 404}).Error(), "HTTP GET failed with status code 404"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+// newTLSConfig creates the TLS configuration from the settings, the server certificate is verified
+// unless settings.Insecure is set
+func newTLSConfig(settings internal.Settings) (*tls.Config, error) {
+	minVersion, err := settings.TLSVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:         minVersion,
+		InsecureSkipVerify: settings.Insecure,
+	}
+
+	if settings.CACertFile != "" {
+		pem, err := os.ReadFile(settings.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %v", settings.CACertFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if settings.ClientCertFile != "" || settings.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(settings.ClientCertFile, settings.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
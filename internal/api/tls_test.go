@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/haevg-rz/git-file-downloader/internal"
+)
+
+func TestHttpGetInternal_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPem, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyFile := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(emptyFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings internal.Settings
+		wantErr  bool
+	}{
+		{
+			name:     "Verify by default",
+			settings: internal.Settings{},
+			wantErr:  true,
+		},
+		{
+			name:     "Insecure",
+			settings: internal.Settings{Insecure: true},
+			wantErr:  false,
+		},
+		{
+			name:     "CA bundle",
+			settings: internal.Settings{CACertFile: caFile},
+			wantErr:  false,
+		},
+		{
+			name:     "CA bundle without certificate",
+			settings: internal.Settings{CACertFile: emptyFile},
+			wantErr:  true,
+		},
+		{
+			name:     "Missing client certificate",
+			settings: internal.Settings{CACertFile: caFile, ClientCertFile: "missing.pem", ClientKeyFile: "missing.key"},
+			wantErr:  true,
+		},
+		{
+			name:     "Minimum TLS version 1.3",
+			settings: internal.Settings{CACertFile: caFile, TLSMinVersion: "1.3"},
+			wantErr:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.settings)
+			if err == nil {
+				_, _, err = httpGetInternal(context.Background(), client.httpClient, server.URL, tt.settings)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("httpGetInternal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"os"
+	"strings"
+)
+
+// Auth types, how the token is sent to the server
+const (
+	// AuthPrivateToken sends a personal, project or group access token in the Private-Token header
+	AuthPrivateToken = "private"
+	// AuthJobToken sends the CI_JOB_TOKEN of a GitLab CI job in the JOB-TOKEN header
+	AuthJobToken = "job"
+	// AuthDeployToken sends a deploy token with its username as basic auth
+	AuthDeployToken = "deploy"
+	// AuthBearer sends an OAuth2 access token as Authorization: Bearer
+	AuthBearer = "bearer"
+)
+
+// Environment variables of GitLab CI jobs
+const (
+	EnvCIJobToken = "CI_JOB_TOKEN"
+	EnvCIApiV4Url = "CI_API_V4_URL"
+)
+
+// WithCIDefaults returns the settings with the job token and API url of a GitLab CI job, if the project
+// is on GitLab, no other token is set and the auth type isn't set to something else
+func (s Settings) WithCIDefaults() Settings {
+	jobToken := os.Getenv(EnvCIJobToken)
+	if jobToken == "" || !s.IsGitLab() || s.PrivateToken != "" || s.TokenFile != "" || s.CredentialHelper {
+		return s
+	}
+	if s.AuthType != "" && s.AuthType != AuthJobToken {
+		return s
+	}
+
+	s.PrivateToken = jobToken
+	s.AuthType = AuthJobToken
+	if s.ApiUrl == "" && os.Getenv(EnvCIApiV4Url) != "" {
+		s.ApiUrl = strings.TrimSuffix(os.Getenv(EnvCIApiV4Url), "/") + "/"
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSettings_WithCIDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		jobToken string
+		settings Settings
+		want     Settings
+	}{
+		{
+			name:     "Not in CI",
+			settings: Settings{},
+			want:     Settings{},
+		},
+		{
+			name:     "Job token",
+			jobToken: "job",
+			settings: Settings{},
+			want:     Settings{PrivateToken: "job", AuthType: AuthJobToken, ApiUrl: "https://gitlab.example.com/api/v4/"},
+		},
+		{
+			name:     "Url is kept",
+			jobToken: "job",
+			settings: Settings{ApiUrl: "https://other.example.com/api/v4/"},
+			want:     Settings{PrivateToken: "job", AuthType: AuthJobToken, ApiUrl: "https://other.example.com/api/v4/"},
+		},
+		{
+			name:     "Token is set",
+			jobToken: "job",
+			settings: Settings{PrivateToken: "token"},
+			want:     Settings{PrivateToken: "token"},
+		},
+		{
+			name:     "Token file is set",
+			jobToken: "job",
+			settings: Settings{TokenFile: "token.txt"},
+			want:     Settings{TokenFile: "token.txt"},
+		},
+		{
+			name:     "Other auth type",
+			jobToken: "job",
+			settings: Settings{AuthType: AuthBearer},
+			want:     Settings{AuthType: AuthBearer},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvCIJobToken, tt.jobToken)
+			t.Setenv(EnvCIApiV4Url, "https://gitlab.example.com/api/v4")
+
+			got := tt.settings.WithCIDefaults()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Settings.WithCIDefaults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the content of a -config file, it describes several sources with their mappings which are
+// synced in a single run
+type Config struct {
+	Sources []ConfigSource `json:"sources"`
+}
+
+// ConfigSource is a project and ref on a GitLab instance or another provider
+type ConfigSource struct {
+	Provider   string    `json:"provider"`
+	Url        string    `json:"url"`
+	Token      string    `json:"token"`
+	TokenFile  string    `json:"tokenFile"`
+	AuthType   string    `json:"authType"`
+	Username   string    `json:"username"`
+	Project    ProjectID `json:"project"`
+	Ref        string    `json:"ref"`
+	Insecure   bool      `json:"insecure"`
+	CACertFile string    `json:"caCertFile"`
+
+	Mappings []ConfigMapping `json:"mappings"`
+}
+
+// ConfigMapping maps a file or folder of the source to a local path
+type ConfigMapping struct {
+	RepoFile   string `json:"repoFile"`
+	OutPath    string `json:"outPath"`
+	RepoFolder string `json:"repoFolder"`
+	OutFolder  string `json:"outFolder"`
+
+	IncludeOnly string `json:"includeonly"`
+	Exclude     string `json:"exclude"`
+	Delete      bool   `json:"delete"`
+	Submodules  string `json:"submodules"`
+
+	FileMode string `json:"fileMode"`
+	DirMode  string `json:"dirMode"`
+
+	OnChange     string `json:"onChange"`
+	OnFileChange string `json:"onFileChange"`
+	Rollback     bool   `json:"rollback"`
+}
+
+// ProjectID is the project ID, namespace path or web URL, in the config file it can be a number or a string
+type ProjectID string
+
+func (p *ProjectID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*p = ProjectID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("project must be a number or a string: %v", string(data))
+	}
+	*p = ProjectID(n.String())
+	return nil
+}
+
+// LoadConfig reads the JSON config file at path, unknown fields are an error to find typos. Relative local
+// paths in it are resolved against the folder of the config file, not the working directory.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var config Config
+	if err := decoder.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("%v: the config must be JSON: %v", path, err)
+	}
+	config.resolvePaths(filepath.Dir(path))
+	for _, source := range config.Sources {
+		if source.Token != "" {
+			if err := checkPrivateFile(FlagNameConfig, path); err != nil {
+				return Config{}, err
+			}
+			break
+		}
+	}
+	return config, nil
+}
+
+// resolvePaths makes the relative local paths of the config absolute to dir
+func (c *Config) resolvePaths(dir string) {
+	resolve := func(p *string) {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	for i := range c.Sources {
+		source := &c.Sources[i]
+		resolve(&source.TokenFile)
+		resolve(&source.CACertFile)
+		for j := range source.Mappings {
+			resolve(&source.Mappings[j].OutPath)
+			resolve(&source.Mappings[j].OutFolder)
+		}
+	}
+}
+
+// Settings returns the settings of every mapping. Fields not set in the config are taken from base,
+// e.g. timeouts, retries and a token given by flag. The token of base is only taken by sources on the
+// same provider and host, so it isn't sent to another host.
+func (c Config) Settings(base Settings) []Settings {
+	base = base.WithProjectUrl().WithProviderDefaults()
+	var all []Settings
+	for _, source := range c.Sources {
+		sourceSettings := base
+		if source.Provider != "" && source.Provider != base.Provider {
+			// The url of the flags is for the other provider
+			sourceSettings.Provider = source.Provider
+			sourceSettings.ApiUrl = ""
+		}
+		override(&sourceSettings.ApiUrl, source.Url)
+		// The token of the source replaces the token of the flags, whatever the source of it is
+		if source.Token != "" || source.TokenFile != "" {
+			sourceSettings.PrivateToken = source.Token
+			sourceSettings.TokenFile = source.TokenFile
+			sourceSettings.CredentialHelper = false
+		}
+		override(&sourceSettings.AuthType, source.AuthType)
+		override(&sourceSettings.Username, source.Username)
+		override(&sourceSettings.ProjectNumber, string(source.Project))
+		override(&sourceSettings.Ref, source.Ref)
+		override(&sourceSettings.CACertFile, source.CACertFile)
+		sourceSettings.Insecure = sourceSettings.Insecure || source.Insecure
+		sourceSettings = sourceSettings.WithProjectUrl().WithProviderDefaults()
+		if source.Token == "" && source.TokenFile == "" && !sameHost(base, sourceSettings) {
+			sourceSettings.PrivateToken = ""
+			sourceSettings.TokenFile = ""
+		}
+
+		for _, mapping := range source.Mappings {
+			s := sourceSettings
+			s.RepoFilePath = mapping.RepoFile
+			s.OutFile = mapping.OutPath
+			s.RepoFolderPath = mapping.RepoFolder
+			s.OutFolder = mapping.OutFolder
+			override(&s.IncludeOnly, mapping.IncludeOnly)
+			override(&s.Exclude, mapping.Exclude)
+			override(&s.Submodules, mapping.Submodules)
+			override(&s.FileMode, mapping.FileMode)
+			override(&s.DirMode, mapping.DirMode)
+			override(&s.OnChange, mapping.OnChange)
+			override(&s.OnFileChange, mapping.OnFileChange)
+			s.Delete = s.Delete || mapping.Delete
+			s.Rollback = s.Rollback || mapping.Rollback
+			all = append(all, s)
+		}
+	}
+	return all
+}
+
+// IsValid validates the settings of every mapping like Settings.IsValid, the messages are prefixed with
+// the position of the mapping in the config file
+func (c Config) IsValid(base Settings) (bool, []string, []string) {
+	var missingArgs []string
+	var errors []string
+
+	all := c.Settings(base)
+	if len(all) == 0 {
+		errors = append(errors, "config has no sources with mappings")
+	}
+
+	for i, source := range c.Sources {
+		if len(source.Mappings) == 0 {
+			errors = append(errors, fmt.Sprintf("sources[%v]: no mappings", i))
+		}
+		for j := range source.Mappings {
+			prefix := fmt.Sprintf("sources[%v].mappings[%v]: ", i, j)
+			_, args, msgs := all[0].IsValid()
+			all = all[1:]
+			for _, arg := range args {
+				missingArgs = append(missingArgs, prefix+arg)
+			}
+			for _, msg := range msgs {
+				errors = append(errors, prefix+msg)
+			}
+		}
+	}
+
+	return len(missingArgs) == 0 && len(errors) == 0, missingArgs, errors
+}
+
+// sameHost returns whether a and b are on the same provider and host
+func sameHost(a, b Settings) bool {
+	if a.IsGitLab() != b.IsGitLab() || !a.IsGitLab() && a.Provider != b.Provider {
+		return false
+	}
+	aUrl, err := url.Parse(a.ApiUrl)
+	if err != nil {
+		return false
+	}
+	bUrl, err := url.Parse(b.ApiUrl)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(aUrl.Host, bUrl.Host)
+}
+
+// override sets *field to value, if value is set
+func override(field *string, value string) {
+	if strings.TrimSpace(value) != "" {
+		*field = value
+	}
+}
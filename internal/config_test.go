@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	folder := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "Number and string project",
+			content: `{"sources": [
+				{"url": "https://gitlab.example.com/api/v4/", "project": 123, "ref": "main", "mappings": [{"repoFile": "a.txt", "outPath": "a.txt"}]},
+				{"url": "https://gitlab.example.com/api/v4/", "project": "group%2Fproject", "mappings": [{"repoFolder": "conf", "outFolder": "conf", "delete": true}]}
+			]}`,
+			want: Config{Sources: []ConfigSource{
+				{Url: "https://gitlab.example.com/api/v4/", Project: "123", Ref: "main", Mappings: []ConfigMapping{{RepoFile: "a.txt", OutPath: filepath.Join(folder, "a.txt")}}},
+				{Url: "https://gitlab.example.com/api/v4/", Project: "group%2Fproject", Mappings: []ConfigMapping{{RepoFolder: "conf", OutFolder: filepath.Join(folder, "conf"), Delete: true}}},
+			}},
+		},
+		{
+			name: "Relative and absolute paths",
+			content: fmt.Sprintf(`{"sources": [
+				{"tokenFile": "token", "caCertFile": "certs/ca.pem", "mappings": [{"repoFile": "a.txt", "outPath": %q}]}
+			]}`, filepath.Join(folder, "out", "a.txt")),
+			want: Config{Sources: []ConfigSource{
+				{TokenFile: filepath.Join(folder, "token"), CACertFile: filepath.Join(folder, "certs", "ca.pem"), Mappings: []ConfigMapping{{RepoFile: "a.txt", OutPath: filepath.Join(folder, "out", "a.txt")}}},
+			}},
+		},
+		{
+			name:    "YAML",
+			content: "sources:\n  - project: 123\n",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown field",
+			content: `{"sources": [{"projectNumber": 123}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid project",
+			content: `{"sources": [{"project": true}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(folder, "gdown.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadConfig(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_TokenPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permissions on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "gdown.json")
+	content := `{"sources": [{"token": "secret", "project": 1, "mappings": [{"repoFile": "a.txt", "outPath": "a.txt"}]}]}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("LoadConfig() of a token in a file readable by others expected an error")
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err != nil {
+		t.Errorf("LoadConfig() error = %v", err)
+	}
+}
+
+func TestConfig_Settings(t *testing.T) {
+	base := Settings{PrivateToken: "flag-token", ApiUrl: "https://gitlab.example.com/api/v4/", Ref: "main", ProjectNumber: "0", Timeout: time.Minute, Exclude: `\.md$`}
+	config := Config{Sources: []ConfigSource{
+		{
+			Project: "1",
+			Ref:     "release",
+			Mappings: []ConfigMapping{
+				{RepoFile: "a.txt", OutPath: "/etc/a.txt", OnChange: "reload"},
+				{RepoFolder: "conf", OutFolder: "/etc/conf", Exclude: `\.log$`, Delete: true},
+			},
+		},
+		{
+			Url:      "https://other.example.com/api/v4/",
+			Token:    "source-token",
+			Project:  "2",
+			Mappings: []ConfigMapping{{RepoFile: "b.txt", OutPath: "/etc/b.txt"}},
+		},
+		{
+			Url:      "https://other.example.com/api/v4/",
+			Project:  "3",
+			Mappings: []ConfigMapping{{RepoFile: "c.txt", OutPath: "/etc/c.txt"}},
+		},
+	}}
+
+	want := []Settings{
+		{PrivateToken: "flag-token", Ref: "release", ApiUrl: "https://gitlab.example.com/api/v4/", ProjectNumber: "1", Timeout: time.Minute, Exclude: `\.md$`,
+			RepoFilePath: "a.txt", OutFile: "/etc/a.txt", OnChange: "reload"},
+		{PrivateToken: "flag-token", Ref: "release", ApiUrl: "https://gitlab.example.com/api/v4/", ProjectNumber: "1", Timeout: time.Minute, Exclude: `\.log$`,
+			RepoFolderPath: "conf", OutFolder: "/etc/conf", Delete: true},
+		{PrivateToken: "source-token", Ref: "main", ApiUrl: "https://other.example.com/api/v4/", ProjectNumber: "2", Timeout: time.Minute, Exclude: `\.md$`,
+			RepoFilePath: "b.txt", OutFile: "/etc/b.txt"},
+		// The token of the flags isn't sent to another host
+		{Ref: "main", ApiUrl: "https://other.example.com/api/v4/", ProjectNumber: "3", Timeout: time.Minute, Exclude: `\.md$`,
+			RepoFilePath: "c.txt", OutFile: "/etc/c.txt"},
+	}
+
+	got := config.Settings(base)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Config.Settings() = %+v, want %+v", got, want)
+	}
+}
+
+func TestConfig_Settings_Provider(t *testing.T) {
+	base := Settings{ApiUrl: "https://gitlab.example.com/api/v4/", PrivateToken: "gitlab-token", Ref: "main"}
+	config := Config{Sources: []ConfigSource{
+		{Provider: ProviderGitHub, Project: "infra/wireguard", Mappings: []ConfigMapping{{RepoFile: "a.txt", OutPath: "a.txt"}}},
+		{Provider: ProviderGitHub, Project: "https://ghe.example.com/infra/wireguard", Mappings: []ConfigMapping{{RepoFile: "a.txt", OutPath: "a.txt"}}},
+	}}
+
+	got := config.Settings(base)
+	if got[0].Provider != ProviderGitHub || got[0].ApiUrl != "https://api.github.com/" {
+		t.Errorf("Config.Settings()[0] = %+v, want the API of github.com", got[0])
+	}
+	if got[0].PrivateToken != "" || got[1].PrivateToken != "" {
+		t.Errorf("Config.Settings() tokens = %q, %q, want none from the GitLab flags", got[0].PrivateToken, got[1].PrivateToken)
+	}
+	if got[1].ApiUrl != "https://ghe.example.com/api/v3/" || got[1].ProjectNumber != "infra/wireguard" {
+		t.Errorf("Config.Settings()[1] = %+v, want the API of the web URL", got[1])
+	}
+}
+
+func TestConfig_IsValid(t *testing.T) {
+	base := Settings{Ref: "main"}
+	tests := []struct {
+		name            string
+		config          Config
+		wantValid       bool
+		wantMissingArgs []string
+		wantErrors      []string
+	}{
+		{
+			name: "Valid config",
+			config: Config{Sources: []ConfigSource{
+				{Url: "https://gitlab.example.com/api/v4/", Token: "token", Project: "1", Mappings: []ConfigMapping{{RepoFile: "a.txt", OutPath: "a.txt"}}},
+			}},
+			wantValid: true,
+		},
+		{
+			name:       "Empty config",
+			config:     Config{},
+			wantValid:  false,
+			wantErrors: []string{"config has no sources with mappings"},
+		},
+		{
+			name: "Invalid mapping",
+			config: Config{Sources: []ConfigSource{
+				{Url: "https://gitlab.example.com/api/v4/", Token: "token", Project: "1", Mappings: []ConfigMapping{
+					{RepoFile: "a.txt", OutPath: "a.txt"},
+					{RepoFolder: "conf", OutFolder: "conf", FileMode: "0999"},
+				}},
+				{Token: "token", Project: "2"},
+			}},
+			wantValid:       false,
+			wantMissingArgs: nil,
+			wantErrors:      []string{"sources[0].mappings[1]: Invalid fileMode 0999, use octal permissions like 0644", "sources[1]: no mappings"},
+		},
+		{
+			name: "Missing url",
+			config: Config{Sources: []ConfigSource{
+				{Token: "token", Project: "1", Mappings: []ConfigMapping{{RepoFile: "a.txt", OutPath: "a.txt"}}},
+			}},
+			wantValid:       false,
+			wantMissingArgs: []string{"sources[0].mappings[0]: url"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotValid, gotMissingArgs, gotErrors := tt.config.IsValid(base)
+			if gotValid != tt.wantValid {
+				t.Errorf("Config.IsValid() gotValid = %v, want %v", gotValid, tt.wantValid)
+			}
+			if !reflect.DeepEqual(gotMissingArgs, tt.wantMissingArgs) {
+				t.Errorf("Config.IsValid() gotMissingArgs = %v, want %v", gotMissingArgs, tt.wantMissingArgs)
+			}
+			if !reflect.DeepEqual(gotErrors, tt.wantErrors) {
+				t.Errorf("Config.IsValid() gotErrors = %v, want %v", gotErrors, tt.wantErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// apiPath is the path of the API v4 below the root of a GitLab instance
+const apiPath = "/api/v4/"
+
+// ProjectPathEscaped returns ProjectNumber for the API: an ID as it is, a namespace path like
+// group/subgroup/project URL-encoded. An already URL-encoded path isn't encoded twice.
+func (s Settings) ProjectPathEscaped() string {
+	project := s.ProjectNumber
+	if unescaped, err := url.PathUnescape(project); err == nil {
+		project = unescaped
+	}
+	return url.PathEscape(project)
+}
+
+// IsProjectUrl returns whether project is the web URL of a project instead of the ID or path
+func IsProjectUrl(project string) bool {
+	return strings.HasPrefix(project, "https://") || strings.HasPrefix(project, "http://")
+}
+
+// WithProjectUrl returns the settings with ProjectNumber replaced by the namespace path, if it is the
+// web URL of a project. Without ApiUrl the API of the same host is used.
+func (s Settings) WithProjectUrl() Settings {
+	if !IsProjectUrl(s.ProjectNumber) {
+		return s
+	}
+	apiUrl, projectPath, err := s.splitProjectUrl()
+	if err != nil {
+		// Reported by IsValid
+		return s
+	}
+	s.ApiUrl = apiUrl
+	s.ProjectNumber = projectPath
+	return s
+}
+
+// splitProjectUrl splits the web URL in ProjectNumber like the provider structures its URLs
+func (s Settings) splitProjectUrl() (string, string, error) {
+	switch s.Provider {
+	case ProviderGitHub:
+		return parseRepoUrl(s.ProjectNumber, s.ApiUrl, gitHubEnterpriseApiPath)
+	case ProviderGitea:
+		return parseRepoUrl(s.ProjectNumber, s.ApiUrl, giteaApiPath)
+	case ProviderBitbucket:
+		return parseBitbucketUrl(s.ProjectNumber, s.ApiUrl)
+	case ProviderAzure:
+		return parseAzureUrl(s.ProjectNumber, s.ApiUrl)
+	}
+	return parseProjectUrl(s.ProjectNumber, s.ApiUrl)
+}
+
+// parseProjectUrl splits the web URL of a project like https://gitlab.example.com/group/project/-/tree/main
+// into the API URL and the namespace path. If apiUrl is set, it is kept and its path before /api/v4/ is
+// the relative URL root of the instance.
+func parseProjectUrl(projectUrl, apiUrl string) (string, string, error) {
+	u, err := url.Parse(projectUrl)
+	if err != nil {
+		return "", "", err
+	}
+
+	root := "/"
+	if apiUrl != "" {
+		a, err := url.Parse(apiUrl)
+		if err != nil {
+			return "", "", err
+		}
+		if a.Host != u.Host {
+			return "", "", fmt.Errorf("project url %v is not on the host of %v %v", projectUrl, FlagNameUrl, apiUrl)
+		}
+		root, _, _ = strings.Cut(a.Path, strings.TrimSuffix(apiPath, "/"))
+		root = strings.TrimSuffix(root, "/") + "/"
+	} else {
+		apiUrl = u.Scheme + "://" + u.Host + apiPath
+	}
+
+	projectPath := strings.TrimPrefix(u.Path, root)
+	// Pages of a project like tree, blob or merge_requests are below /-/
+	projectPath, _, _ = strings.Cut(projectPath, "/-/")
+	projectPath = strings.TrimSuffix(strings.Trim(projectPath, "/"), ".git")
+	if !strings.Contains(projectPath, "/") {
+		return "", "", fmt.Errorf("project url %v has no namespace and project", projectUrl)
+	}
+	return apiUrl, projectPath, nil
+}
@@ -0,0 +1,271 @@
+package internal
+
+import "testing"
+
+func TestSettings_ProjectPathEscaped(t *testing.T) {
+	tests := []struct {
+		project string
+		want    string
+	}{
+		{project: "16447351", want: "16447351"},
+		{project: "infra/servers/wireguard", want: "infra%2Fservers%2Fwireguard"},
+		{project: "infra%2Fservers%2Fwireguard", want: "infra%2Fservers%2Fwireguard"},
+		{project: "group/my project", want: "group%2Fmy%20project"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.project, func(t *testing.T) {
+			if got := (Settings{ProjectNumber: tt.project}).ProjectPathEscaped(); got != tt.want {
+				t.Errorf("Settings.ProjectPathEscaped() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseProjectUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		projectUrl  string
+		apiUrl      string
+		wantApiUrl  string
+		wantProject string
+		wantErr     bool
+	}{
+		{
+			name:        "Project",
+			projectUrl:  "https://gitlab.example.com/infra/servers/wireguard",
+			wantApiUrl:  "https://gitlab.example.com/api/v4/",
+			wantProject: "infra/servers/wireguard",
+		},
+		{
+			name:        "Clone url",
+			projectUrl:  "https://gitlab.example.com/infra/wireguard.git",
+			wantApiUrl:  "https://gitlab.example.com/api/v4/",
+			wantProject: "infra/wireguard",
+		},
+		{
+			name:        "Page of the project",
+			projectUrl:  "https://gitlab.example.com/infra/wireguard/-/tree/main/conf",
+			wantApiUrl:  "https://gitlab.example.com/api/v4/",
+			wantProject: "infra/wireguard",
+		},
+		{
+			name:        "Relative url root",
+			projectUrl:  "https://example.com/gitlab/infra/wireguard",
+			apiUrl:      "https://example.com/gitlab/api/v4/",
+			wantApiUrl:  "https://example.com/gitlab/api/v4/",
+			wantProject: "infra/wireguard",
+		},
+		{
+			name:       "Other host than url",
+			projectUrl: "https://gitlab.example.com/infra/wireguard",
+			apiUrl:     "https://other.example.com/api/v4/",
+			wantErr:    true,
+		},
+		{
+			name:       "No project",
+			projectUrl: "https://gitlab.example.com/infra",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotApiUrl, gotProject, err := parseProjectUrl(tt.projectUrl, tt.apiUrl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProjectUrl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotApiUrl != tt.wantApiUrl || gotProject != tt.wantProject {
+				t.Errorf("parseProjectUrl() = %v, %v, want %v, %v", gotApiUrl, gotProject, tt.wantApiUrl, tt.wantProject)
+			}
+		})
+	}
+}
+
+func Test_parseRepoUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		projectUrl  string
+		apiUrl      string
+		apiPath     string
+		wantApiUrl  string
+		wantProject string
+		wantErr     bool
+	}{
+		{
+			name:        "github.com",
+			projectUrl:  "https://github.com/haevg-rz/git-file-downloader/tree/main/cmd",
+			wantApiUrl:  "https://api.github.com/",
+			wantProject: "haevg-rz/git-file-downloader",
+		},
+		{
+			name:        "GitHub Enterprise Server",
+			projectUrl:  "https://ghe.example.com/infra/wireguard.git",
+			wantApiUrl:  "https://ghe.example.com/api/v3/",
+			wantProject: "infra/wireguard",
+		},
+		{
+			name:        "Gitea",
+			projectUrl:  "https://gitea.example.com/infra/wireguard/src/branch/main",
+			apiPath:     giteaApiPath,
+			wantApiUrl:  "https://gitea.example.com/api/v1/",
+			wantProject: "infra/wireguard",
+		},
+		{
+			name:        "Gitea with relative url root",
+			projectUrl:  "https://example.com/git/infra/wireguard",
+			apiUrl:      "https://example.com/git/api/v1/",
+			apiPath:     giteaApiPath,
+			wantApiUrl:  "https://example.com/git/api/v1/",
+			wantProject: "infra/wireguard",
+		},
+		{
+			name:        "Url of github.com is kept",
+			projectUrl:  "https://github.com/infra/wireguard",
+			apiUrl:      "https://api.github.com/",
+			wantApiUrl:  "https://api.github.com/",
+			wantProject: "infra/wireguard",
+		},
+		{
+			name:       "Other host than url",
+			projectUrl: "https://github.com/infra/wireguard",
+			apiUrl:     "https://ghe.example.com/api/v3/",
+			wantErr:    true,
+		},
+		{
+			name:       "No repository",
+			projectUrl: "https://github.com/infra",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiPath := tt.apiPath
+			if apiPath == "" {
+				apiPath = gitHubEnterpriseApiPath
+			}
+			gotApiUrl, gotProject, err := parseRepoUrl(tt.projectUrl, tt.apiUrl, apiPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRepoUrl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotApiUrl != tt.wantApiUrl || gotProject != tt.wantProject {
+				t.Errorf("parseRepoUrl() = %v, %v, want %v, %v", gotApiUrl, gotProject, tt.wantApiUrl, tt.wantProject)
+			}
+		})
+	}
+}
+
+func TestSettings_splitProjectUrl(t *testing.T) {
+	tests := []struct {
+		name        string
+		settings    Settings
+		wantApiUrl  string
+		wantProject string
+		wantErr     bool
+	}{
+		{
+			name:        "Bitbucket",
+			settings:    Settings{Provider: ProviderBitbucket, ProjectNumber: "https://bitbucket.example.com/projects/INFRA/repos/wireguard/browse/conf"},
+			wantApiUrl:  "https://bitbucket.example.com/rest/api/latest/",
+			wantProject: "INFRA/wireguard",
+		},
+		{
+			name:        "Bitbucket user repository with context path",
+			settings:    Settings{Provider: ProviderBitbucket, ProjectNumber: "https://example.com/bitbucket/users/jane/repos/dotfiles"},
+			wantApiUrl:  "https://example.com/bitbucket/rest/api/latest/",
+			wantProject: "~jane/dotfiles",
+		},
+		{
+			name:        "Bitbucket clone url",
+			settings:    Settings{Provider: ProviderBitbucket, ProjectNumber: "https://bitbucket.example.com/scm/infra/wireguard.git", ApiUrl: "https://bitbucket.example.com/rest/api/1.0/"},
+			wantApiUrl:  "https://bitbucket.example.com/rest/api/1.0/",
+			wantProject: "infra/wireguard",
+		},
+		{
+			name:        "Azure DevOps Services",
+			settings:    Settings{Provider: ProviderAzure, ProjectNumber: "https://dev.azure.com/contoso/Infra/_git/wireguard?path=/conf"},
+			wantApiUrl:  "https://dev.azure.com/contoso/",
+			wantProject: "Infra/wireguard",
+		},
+		{
+			name:        "Azure DevOps Server",
+			settings:    Settings{Provider: ProviderAzure, ProjectNumber: "https://tfs.example.com/tfs/DefaultCollection/Infra/_git/wireguard"},
+			wantApiUrl:  "https://tfs.example.com/tfs/DefaultCollection/",
+			wantProject: "Infra/wireguard",
+		},
+		{
+			name:     "Azure DevOps without repository",
+			settings: Settings{Provider: ProviderAzure, ProjectNumber: "https://dev.azure.com/contoso/Infra"},
+			wantErr:  true,
+		},
+		{
+			name:     "Azure DevOps on another host than url",
+			settings: Settings{Provider: ProviderAzure, ProjectNumber: "https://dev.azure.com/contoso/Infra/_git/wireguard", ApiUrl: "https://tfs.example.com/tfs/DefaultCollection/"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotApiUrl, gotProject, err := tt.settings.splitProjectUrl()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Settings.splitProjectUrl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotApiUrl != tt.wantApiUrl || gotProject != tt.wantProject {
+				t.Errorf("Settings.splitProjectUrl() = %v, %v, want %v, %v", gotApiUrl, gotProject, tt.wantApiUrl, tt.wantProject)
+			}
+		})
+	}
+}
+
+func TestSettings_WithProjectUrl(t *testing.T) {
+	got := Settings{ProjectNumber: "https://gitlab.example.com/infra/wireguard"}.WithProjectUrl()
+	if got.ApiUrl != "https://gitlab.example.com/api/v4/" || got.ProjectNumber != "infra/wireguard" {
+		t.Errorf("Settings.WithProjectUrl() = %+v", got)
+	}
+
+	invalid := Settings{ProjectNumber: "https://gitlab.example.com/infra"}
+	if got := invalid.WithProjectUrl(); got != invalid {
+		t.Errorf("Settings.WithProjectUrl() = %+v, want unchanged", got)
+	}
+	if valid, _, _ := invalid.IsValid(); valid {
+		t.Error("Settings.IsValid() with invalid project url = true, want false")
+	}
+}
+
+func TestSettings_WithProviderDefaults(t *testing.T) {
+	got := Settings{Provider: ProviderGitHub, ProjectNumber: "haevg-rz/git-file-downloader"}.WithProviderDefaults()
+	if got.ApiUrl != "https://api.github.com/" {
+		t.Errorf("Settings.WithProviderDefaults() = %+v", got)
+	}
+
+	got = Settings{Provider: ProviderGitLab, ApiUrl: "file:///srv/git/config.git"}.WithProviderDefaults()
+	if got.Provider != ProviderGit {
+		t.Errorf("Settings.WithProviderDefaults() with file url = %+v, want provider git", got)
+	}
+}
+
+func TestSettings_LFSUrl(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		want     string
+	}{
+		{name: "GitLab", settings: Settings{ApiUrl: "https://gitlab.example.com/gitlab/api/v4/", ProjectNumber: "infra/servers/wireguard"}, want: "https://gitlab.example.com/gitlab/infra/servers/wireguard.git/info/lfs"},
+		{name: "GitHub", settings: Settings{Provider: ProviderGitHub, ApiUrl: "https://api.github.com/", ProjectNumber: "infra/wireguard"}, want: "https://github.com/infra/wireguard.git/info/lfs"},
+		{name: "GitHub Enterprise", settings: Settings{Provider: ProviderGitHub, ApiUrl: "https://github.example.com/api/v3/", ProjectNumber: "infra/wireguard"}, want: "https://github.example.com/infra/wireguard.git/info/lfs"},
+		{name: "Gitea", settings: Settings{Provider: ProviderGitea, ApiUrl: "https://gitea.example.com/api/v1/", ProjectNumber: "infra/wireguard"}, want: "https://gitea.example.com/infra/wireguard.git/info/lfs"},
+		{name: "Bitbucket", settings: Settings{Provider: ProviderBitbucket, ApiUrl: "https://bitbucket.example.com/rest/api/latest/", ProjectNumber: "INFRA/wireguard"}, want: "https://bitbucket.example.com/scm/INFRA/wireguard.git/info/lfs"},
+		{name: "Azure DevOps", settings: Settings{Provider: ProviderAzure, ApiUrl: "https://dev.azure.com/org/", ProjectNumber: "infra/wireguard"}, want: "https://dev.azure.com/org/infra/_git/wireguard.git/info/lfs"},
+		{name: "Git", settings: Settings{Provider: ProviderGit, ApiUrl: "https://git.example.com/config.git"}, want: "https://git.example.com/config.git/info/lfs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.settings.LFSUrl(); got != tt.want {
+				t.Errorf("Settings.LFSUrl() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
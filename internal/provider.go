@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Providers, the git hosting service of the project
+const (
+	ProviderGitLab = "gitlab"
+	ProviderGitHub = "github"
+	// ProviderGitea is Gitea and its fork Forgejo, which have the same API
+	ProviderGitea = "gitea"
+	// ProviderBitbucket is Bitbucket Server and Data Center, not Bitbucket Cloud
+	ProviderBitbucket = "bitbucket"
+	// ProviderAzure is Azure DevOps Services and Server (Azure Repos)
+	ProviderAzure = "azure"
+	// ProviderGit is a git repository read with the git command, a local path or file:// URL, or a smart
+	// HTTP remote which is fetched into GitCache
+	ProviderGit = "git"
+)
+
+// API urls and paths of the providers, a web URL of a repository sets the API url of its host
+const (
+	// gitHubApiUrl is the API of github.com, GitHub Enterprise Server has its API below /api/v3/
+	gitHubApiUrl            = "https://api.github.com/"
+	gitHubEnterpriseApiPath = "/api/v3/"
+	giteaApiPath            = "/api/v1/"
+	bitbucketApiPath        = "/rest/api/latest/"
+)
+
+// projectFormats is the form of ProjectNumber for the providers other than GitLab
+var projectFormats = map[string]string{
+	ProviderGitHub:    "owner/repo",
+	ProviderGitea:     "owner/repo",
+	ProviderBitbucket: "KEY/repo",
+	ProviderAzure:     "project/repo",
+}
+
+// IsGitLab returns whether the project is on GitLab, which is the default provider
+func (s Settings) IsGitLab() bool {
+	return s.Provider == "" || s.Provider == ProviderGitLab
+}
+
+// WithProviderDefaults returns the settings with the API url of github.com, if the provider is GitHub
+// and no url is set. A file:// url is a local repository, so the GitLab default becomes ProviderGit.
+func (s Settings) WithProviderDefaults() Settings {
+	if s.Provider == ProviderGitHub && s.ApiUrl == "" && !IsProjectUrl(s.ProjectNumber) {
+		s.ApiUrl = gitHubApiUrl
+	}
+	if s.IsGitLab() && IsFileUrl(s.ApiUrl) {
+		s.Provider = ProviderGit
+	}
+	return s
+}
+
+// IsFileUrl returns whether apiUrl is the file:// URL of a local repository
+func IsFileUrl(apiUrl string) bool {
+	return strings.HasPrefix(apiUrl, "file://")
+}
+
+// RepoPathEscaped returns ProjectNumber like owner/repo for the APIs of GitHub and Gitea, both parts
+// URL-encoded. For Bitbucket it is the project key and the repository slug, for Azure DevOps the project
+// and the repository.
+func (s Settings) RepoPathEscaped() string {
+	project := s.ProjectNumber
+	if unescaped, err := url.PathUnescape(project); err == nil {
+		project = unescaped
+	}
+	owner, repo, _ := strings.Cut(project, "/")
+	return url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+// isOwnerRepo returns whether project is owner/repo, possibly URL-encoded
+func isOwnerRepo(project string) bool {
+	if unescaped, err := url.PathUnescape(project); err == nil {
+		project = unescaped
+	}
+	owner, repo, found := strings.Cut(project, "/")
+	return found && owner != "" && repo != "" && !strings.Contains(repo, "/")
+}
+
+// parseRepoUrl splits the web URL of a repository like https://github.com/owner/repo/tree/main, where the
+// pages of the repository follow owner/repo, into the API URL and owner/repo. Without apiUrl the API is
+// below apiPath on the same host, except for github.com with its API on api.github.com. If apiUrl is set,
+// it is kept and its path before apiPath is the relative URL root of the instance.
+func parseRepoUrl(projectUrl, apiUrl, apiPath string) (string, string, error) {
+	u, err := url.Parse(projectUrl)
+	if err != nil {
+		return "", "", err
+	}
+
+	root := "/"
+	if apiUrl == "" {
+		apiUrl = u.Scheme + "://" + u.Host + apiPath
+		if strings.EqualFold(u.Host, "github.com") {
+			apiUrl = gitHubApiUrl
+		}
+	} else {
+		a, err := url.Parse(apiUrl)
+		if err != nil {
+			return "", "", err
+		}
+		if !strings.EqualFold(a.Host, u.Host) && !strings.EqualFold(a.Host, "api."+u.Host) {
+			return "", "", fmt.Errorf("project url %v is not on the host of %v %v", projectUrl, FlagNameUrl, apiUrl)
+		}
+		if strings.EqualFold(a.Host, u.Host) {
+			root, _, _ = strings.Cut(a.Path, strings.TrimSuffix(apiPath, "/"))
+			root = strings.TrimSuffix(root, "/") + "/"
+		}
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(u.Path, root), "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("project url %v has no owner and repository", projectUrl)
+	}
+	return apiUrl, parts[0] + "/" + strings.TrimSuffix(parts[1], ".git"), nil
+}
+
+// parseBitbucketUrl splits the web or clone URL of a Bitbucket repository like
+// https://bitbucket.example.com/projects/INFRA/repos/wireguard/browse into the API URL and KEY/slug. The
+// repository of a user like /users/jane/repos/dotfiles is ~jane/dotfiles.
+func parseBitbucketUrl(projectUrl, apiUrl string) (string, string, error) {
+	u, err := url.Parse(projectUrl)
+	if err != nil {
+		return "", "", err
+	}
+	if apiUrl != "" {
+		if err := checkSameHost(projectUrl, u.Host, apiUrl); err != nil {
+			return "", "", err
+		}
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		var projectPath string
+		switch {
+		case parts[i] == "projects" && i+3 < len(parts) && parts[i+2] == "repos":
+			projectPath = parts[i+1] + "/" + parts[i+3]
+		case parts[i] == "users" && i+3 < len(parts) && parts[i+2] == "repos":
+			projectPath = "~" + parts[i+1] + "/" + parts[i+3]
+		case parts[i] == "scm":
+			projectPath = parts[i+1] + "/" + strings.TrimSuffix(parts[i+2], ".git")
+		default:
+			continue
+		}
+		if apiUrl == "" {
+			apiUrl = u.Scheme + "://" + u.Host + strings.TrimSuffix("/"+strings.Join(parts[:i], "/"), "/") + bitbucketApiPath
+		}
+		return apiUrl, projectPath, nil
+	}
+	return "", "", fmt.Errorf("project url %v has no project and repository", projectUrl)
+}
+
+// parseAzureUrl splits the web or clone URL of an Azure Repos repository like
+// https://dev.azure.com/org/project/_git/repo into the API URL of the organization or collection, like
+// https://dev.azure.com/org/, and project/repo
+func parseAzureUrl(projectUrl, apiUrl string) (string, string, error) {
+	u, err := url.Parse(projectUrl)
+	if err != nil {
+		return "", "", err
+	}
+	if apiUrl != "" {
+		if err := checkSameHost(projectUrl, u.Host, apiUrl); err != nil {
+			return "", "", err
+		}
+	}
+
+	before, after, found := strings.Cut(strings.Trim(u.Path, "/"), "/_git/")
+	repo, _, _ := strings.Cut(after, "/")
+	slash := strings.LastIndex(before, "/")
+	if !found || repo == "" || before == "" {
+		return "", "", fmt.Errorf("project url %v has no project and repository", projectUrl)
+	}
+	if apiUrl == "" {
+		apiUrl = u.Scheme + "://" + u.Host + "/" + before[:slash+1]
+	}
+	return apiUrl, before[slash+1:] + "/" + repo, nil
+}
+
+// checkSameHost returns an error if apiUrl is not on host, the host of projectUrl
+func checkSameHost(projectUrl, host, apiUrl string) error {
+	a, err := url.Parse(apiUrl)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(a.Host, host) {
+		return fmt.Errorf("project url %v is not on the host of %v %v", projectUrl, FlagNameUrl, apiUrl)
+	}
+	return nil
+}
+
+// LFSUrl returns the URL of the Git LFS API of the repository, below its clone URL like git-lfs finds it.
+// For GitLab, ProjectNumber must be the namespace path, an ID has no clone URL.
+func (s Settings) LFSUrl() string {
+	project := s.ProjectNumber
+	if unescaped, err := url.PathUnescape(project); err == nil {
+		project = unescaped
+	}
+
+	var cloneUrl string
+	switch s.Provider {
+	case "", ProviderGitLab:
+		cloneUrl = instanceRoot(s.ApiUrl, apiPath) + escapeProjectPath(project)
+	case ProviderGitHub:
+		root := "https://github.com/"
+		if s.ApiUrl != gitHubApiUrl {
+			root = instanceRoot(s.ApiUrl, gitHubEnterpriseApiPath)
+		}
+		cloneUrl = root + s.RepoPathEscaped()
+	case ProviderGitea:
+		cloneUrl = instanceRoot(s.ApiUrl, giteaApiPath) + s.RepoPathEscaped()
+	case ProviderBitbucket:
+		cloneUrl = instanceRoot(s.ApiUrl, bitbucketApiPath) + "scm/" + s.RepoPathEscaped()
+	case ProviderAzure:
+		projectName, repo, _ := strings.Cut(s.RepoPathEscaped(), "/")
+		cloneUrl = s.ApiUrl + projectName + "/_git/" + repo
+	default:
+		cloneUrl = s.ApiUrl
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(cloneUrl, "/"), ".git") + ".git/info/lfs"
+}
+
+// instanceRoot returns apiUrl without apiPath, the root of the instance with a trailing slash
+func instanceRoot(apiUrl, apiPath string) string {
+	root, _, _ := strings.Cut(apiUrl, strings.TrimSuffix(apiPath, "/"))
+	return strings.TrimSuffix(root, "/") + "/"
+}
+
+// escapeProjectPath URL-encodes every part of a namespace path like group/subgroup/project
+func escapeProjectPath(project string) string {
+	parts := strings.Split(project, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
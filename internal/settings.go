@@ -1,32 +1,147 @@
 package internal
 
-import "fmt"
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
 
 const (
 	FlagNameToken                 = "token"
 	FlagNameOutPath               = "outPath"
 	FlagNameOutFolder             = "outFolder"
 	FlagNameBranch                = "branch"
+	FlagNameRef                   = "ref"
 	FlagNameUrl                   = "url"
 	FlagNameProjectNumber         = "projectNumber"
+	FlagNameProject               = "project"
 	FlagNameRepoFilePath          = "repoFilePath"
 	FlagNameRepoFolderPathEscaped = "repoFolder"
 	IncludeOnly                   = "includeonly"
 	Exclude                       = "exclude"
+	FlagNameInsecure              = "insecure"
+	FlagNameCACertFile            = "caCertFile"
+	FlagNameClientCertFile        = "clientCertFile"
+	FlagNameClientKeyFile         = "clientKeyFile"
+	FlagNameTLSMinVersion         = "tlsMinVersion"
+	FlagNameConnectTimeout        = "connectTimeout"
+	FlagNameTimeout               = "timeout"
+	FlagNameRetries               = "retries"
+	FlagNameRetryWait             = "retryWait"
+	FlagNameRetryMaxWait          = "retryMaxWait"
+	FlagNameParallel              = "parallel"
+	FlagNameDelete                = "delete"
+	FlagNameFileMode              = "fileMode"
+	FlagNameDirMode               = "dirMode"
+	FlagNameSubmodules            = "submodules"
+	FlagNameOnChange              = "onChange"
+	FlagNameOnFileChange          = "onFileChange"
+	FlagNameHookTimeout           = "hookTimeout"
+	FlagNameRollback              = "rollback"
+	FlagNameDryRun                = "dry-run"
+	FlagNamePlanFormat            = "planFormat"
+	FlagNameConfig                = "config"
+	FlagNameTokenFile             = "tokenFile"
+	FlagNameCredentialHelper      = "credentialHelper"
+	FlagNameAuthType              = "authType"
+	FlagNameUsername              = "username"
+	FlagNameProvider              = "provider"
+	FlagNameGitCache              = "gitCache"
+)
+
+const (
+	// GitModeExecutable is the git mode of an executable file
+	GitModeExecutable = "100755"
+	// GitModeSymlink is the git mode of a symbolic link, the content is the link target
+	GitModeSymlink = "120000"
+)
+
+const (
+	SubmodulesSkip    = "skip"
+	SubmodulesRecurse = "recurse"
+)
+
+const (
+	PlanFormatText = "text"
+	PlanFormatJSON = "json"
 )
 
 type Settings struct {
-	PrivateToken   string
-	OutFile        string
-	OutFolder      string
-	Branch         string
-	ApiUrl         string
+	// Provider is the git hosting service, ProviderGitLab if empty
+	Provider string
+
+	PrivateToken string
+	// TokenFile and CredentialHelper are the other sources of the token, see ResolveToken
+	TokenFile        string
+	CredentialHelper bool
+	// AuthType is how the token is sent, AuthPrivateToken (GitLab), basic auth (Azure DevOps) or AuthBearer
+	// (other providers) if empty.
+	// Username is for AuthDeployToken.
+	AuthType string
+	Username string
+
+	OutFile   string
+	OutFolder string
+	// Ref is a branch, tag or commit SHA
+	Ref string
+	// ApiUrl is the url of the API, for ProviderGit the path or url of the repository
+	ApiUrl string
+	// GitCache is the folder of the bare repositories fetched by ProviderGit, the user cache dir if empty
+	GitCache string
+	// ProjectNumber is the ID or namespace path like group/subgroup/project, see ProjectPathEscaped. On
+	// the other providers it is owner/repo, see RepoPathEscaped.
 	ProjectNumber  string
 	RepoFilePath   string
 	RepoFolderPath string
 	UserAgent      string
 	IncludeOnly    string
 	Exclude        string
+
+	// Insecure disables the verification of the server certificate
+	Insecure       bool
+	CACertFile     string
+	ClientCertFile string
+	ClientKeyFile  string
+	TLSMinVersion  string
+
+	// ConnectTimeout limits connecting incl. TLS handshake, Timeout the wait for the response and every read
+	// of its body, zero means no limit
+	ConnectTimeout time.Duration
+	Timeout        time.Duration
+
+	// Retries is the number of retries after network errors, 429 and 5xx responses
+	Retries      int
+	RetryWait    time.Duration
+	RetryMaxWait time.Duration
+
+	// Parallel is the number of parallel downloads in folder mode, zero is the same as one
+	Parallel int
+	// Delete removes local files in folder mode which are not in the remote folder
+	Delete bool
+
+	// RepoFileMode is the git mode of RepoFilePath like 100644 or 100755, RepoFileID its git blob ID,
+	// both are known from the tree in folder mode and empty in file mode
+	RepoFileMode string
+	RepoFileID   string
+	// FileMode and DirMode override the permissions of written files and created folders, octal like 0640
+	FileMode string
+	DirMode  string
+
+	// Submodules is SubmodulesSkip (default) or SubmodulesRecurse to sync submodules from their project
+	Submodules string
+
+	// OnChange runs once per run if anything changed, OnFileChange after every changed file
+	OnChange     string
+	OnFileChange string
+	HookTimeout  time.Duration
+	// Rollback restores the previous files if a hook fails
+	Rollback bool
+
+	// DryRun compares the files but doesn't change anything on disk, the plan is printed in PlanFormat
+	DryRun     bool
+	PlanFormat string
 }
 
 type Mode int
@@ -51,7 +166,8 @@ func (s Settings) IsValid() (bool, []string, []string) {
 	var missingArgs []string
 	var errors []string
 
-	if s.PrivateToken == "" {
+	// A local repository needs no token and a remote of ProviderGit may be public
+	if s.PrivateToken == "" && s.TokenFile == "" && !s.CredentialHelper && s.Provider != ProviderGit {
 		missingArgs = append(missingArgs, FlagNameToken)
 	}
 	// Missmatch between outFile and outFolder is not allowed
@@ -70,8 +186,8 @@ func (s Settings) IsValid() (bool, []string, []string) {
 	if s.RepoFolderPath != "" && s.OutFolder == "" {
 		missingArgs = append(missingArgs, FlagNameOutFolder)
 	}
-	if s.Branch == "" {
-		missingArgs = append(missingArgs, FlagNameBranch)
+	if s.Ref == "" {
+		missingArgs = append(missingArgs, FlagNameRef)
 	}
 	if s.RepoFilePath == "" && s.RepoFolderPath == "" {
 		missingArgs = append(missingArgs, FlagNameRepoFilePath)
@@ -80,5 +196,123 @@ func (s Settings) IsValid() (bool, []string, []string) {
 		missingArgs = append(missingArgs, FlagNameUrl)
 	}
 
-	return len(missingArgs) == 0, missingArgs, errors
+	if s.ClientCertFile != "" && s.ClientKeyFile == "" {
+		missingArgs = append(missingArgs, FlagNameClientKeyFile)
+	}
+	if s.ClientKeyFile != "" && s.ClientCertFile == "" {
+		missingArgs = append(missingArgs, FlagNameClientCertFile)
+	}
+	if s.ConnectTimeout < 0 || s.Timeout < 0 {
+		errors = append(errors, fmt.Sprint(FlagNameConnectTimeout, " and ", FlagNameTimeout, " must not be negative"))
+	}
+	if s.Retries < 0 || s.RetryWait < 0 || s.RetryMaxWait < 0 {
+		errors = append(errors, fmt.Sprint(FlagNameRetries, ", ", FlagNameRetryWait, " and ", FlagNameRetryMaxWait, " must not be negative"))
+	}
+	if s.Delete && s.OutFolder == "" {
+		errors = append(errors, fmt.Sprint(FlagNameDelete, " can only be used with ", FlagNameOutFolder))
+	}
+	if s.Parallel < 0 {
+		errors = append(errors, fmt.Sprint(FlagNameParallel, " must not be negative"))
+	}
+	if s.Submodules != "" && s.Submodules != SubmodulesSkip && s.Submodules != SubmodulesRecurse {
+		errors = append(errors, fmt.Sprint("Unknown ", FlagNameSubmodules, " ", s.Submodules, ", use ", SubmodulesSkip, " or ", SubmodulesRecurse))
+	}
+	if s.Rollback && s.OnChange == "" && s.OnFileChange == "" {
+		errors = append(errors, fmt.Sprint(FlagNameRollback, " needs ", FlagNameOnChange, " or ", FlagNameOnFileChange))
+	}
+	if s.HookTimeout < 0 {
+		errors = append(errors, fmt.Sprint(FlagNameHookTimeout, " must not be negative"))
+	}
+	switch s.AuthType {
+	case "", AuthPrivateToken, AuthJobToken, AuthBearer:
+	case AuthDeployToken:
+		if s.Username == "" {
+			missingArgs = append(missingArgs, FlagNameUsername)
+		}
+	default:
+		errors = append(errors, fmt.Sprint("Unknown ", FlagNameAuthType, " ", s.AuthType, ", use ", AuthPrivateToken, ", ", AuthJobToken, ", ", AuthDeployToken, " or ", AuthBearer))
+	}
+	switch s.Provider {
+	case "", ProviderGitLab:
+	case ProviderGitHub, ProviderGitea, ProviderBitbucket, ProviderAzure:
+		if s.AuthType == AuthPrivateToken || s.AuthType == AuthJobToken {
+			errors = append(errors, fmt.Sprint(FlagNameAuthType, " ", s.AuthType, " is only supported by ", ProviderGitLab, ", use ", AuthBearer, " or ", AuthDeployToken))
+		}
+		if !IsProjectUrl(s.ProjectNumber) && !isOwnerRepo(s.ProjectNumber) {
+			errors = append(errors, fmt.Sprint("Invalid ", FlagNameProject, " ", s.ProjectNumber, ", use ", projectFormats[s.Provider], " for ", s.Provider))
+		}
+	case ProviderGit:
+		if s.AuthType == AuthPrivateToken || s.AuthType == AuthJobToken {
+			errors = append(errors, fmt.Sprint(FlagNameAuthType, " ", s.AuthType, " is only supported by ", ProviderGitLab, ", use ", AuthBearer, " or ", AuthDeployToken))
+		}
+		if s.Submodules == SubmodulesRecurse {
+			errors = append(errors, fmt.Sprint(FlagNameSubmodules, " ", SubmodulesRecurse, " is not supported by ", ProviderGit))
+		}
+	default:
+		errors = append(errors, fmt.Sprint("Unknown ", FlagNameProvider, " ", s.Provider, ", use ", ProviderGitLab, ", ", ProviderGitHub, ", ", ProviderGitea, ", ", ProviderBitbucket, ", ", ProviderAzure, " or ", ProviderGit))
+	}
+	if IsProjectUrl(s.ProjectNumber) {
+		if _, _, err := s.splitProjectUrl(); err != nil {
+			errors = append(errors, fmt.Sprint("Invalid ", FlagNameProject, " ", err))
+		}
+	}
+	if s.PlanFormat != "" && s.PlanFormat != PlanFormatText && s.PlanFormat != PlanFormatJSON {
+		errors = append(errors, fmt.Sprint("Unknown ", FlagNamePlanFormat, " ", s.PlanFormat, ", use ", PlanFormatText, " or ", PlanFormatJSON))
+	}
+	if _, err := s.FilePerm(); err != nil {
+		errors = append(errors, err.Error())
+	}
+	if _, err := s.DirPerm(); err != nil {
+		errors = append(errors, err.Error())
+	}
+	if _, err := s.TLSVersion(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	return len(missingArgs) == 0 && len(errors) == 0, missingArgs, errors
+}
+
+// TLSVersion returns the minimum TLS version, default is TLS 1.2
+func (s Settings) TLSVersion() (uint16, error) {
+	switch s.TLSMinVersion {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("Unknown %v %v, use 1.0, 1.1, 1.2 or 1.3", FlagNameTLSMinVersion, s.TLSMinVersion)
+}
+
+// FilePerm returns the permissions for OutFile, 0644 or FileMode. Executable files (git mode 100755)
+// get the execute bit wherever the read bit is set, like 0755. They only apply if the git mode is known
+// or FileMode is set, otherwise the permissions of the local file are kept.
+func (s Settings) FilePerm() (os.FileMode, error) {
+	perm, err := parsePerm(FlagNameFileMode, s.FileMode, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if s.RepoFileMode == GitModeExecutable {
+		perm |= (perm & 0444) >> 2
+	}
+	return perm, nil
+}
+
+// DirPerm returns the permissions for created folders, 0755 or DirMode
+func (s Settings) DirPerm() (os.FileMode, error) {
+	return parsePerm(FlagNameDirMode, s.DirMode, 0755)
+}
+
+func parsePerm(name, value string, defaultPerm os.FileMode) (os.FileMode, error) {
+	if value == "" {
+		return defaultPerm, nil
+	}
+	perm, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("Invalid %v %v, use octal permissions like 0644", name, value)
+	}
+	return os.FileMode(perm), nil
 }
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"os"
 	"reflect"
 	"testing"
 )
@@ -56,7 +57,21 @@ func TestSettings_IsValid(t *testing.T) {
 			settings: Settings{
 				PrivateToken:  "token",
 				OutFile:       "output.txt",
-				Branch:        "main",
+				Ref:           "main",
+				ApiUrl:        "https://api.example.com",
+				RepoFilePath:  "repo/file.txt",
+				ProjectNumber: "123",
+			},
+			wantValid:       true,
+			wantMissingArgs: nil,
+			wantErrors:      nil,
+		},
+		{
+			name: "Token file instead of token",
+			settings: Settings{
+				TokenFile:     "token.txt",
+				OutFile:       "output.txt",
+				Ref:           "main",
 				ApiUrl:        "https://api.example.com",
 				RepoFilePath:  "repo/file.txt",
 				ProjectNumber: "123",
@@ -71,7 +86,7 @@ func TestSettings_IsValid(t *testing.T) {
 				OutFile: "output.txt",
 			},
 			wantValid:       false,
-			wantMissingArgs: []string{FlagNameToken, FlagNameBranch, FlagNameRepoFilePath, FlagNameUrl},
+			wantMissingArgs: []string{FlagNameToken, FlagNameRef, FlagNameRepoFilePath, FlagNameUrl},
 			wantErrors:      nil,
 		},
 		{
@@ -80,7 +95,7 @@ func TestSettings_IsValid(t *testing.T) {
 				PrivateToken:  "token",
 				OutFile:       "output.txt",
 				OutFolder:     "output",
-				Branch:        "main",
+				Ref:           "main",
 				ApiUrl:        "https://api.example.com",
 				RepoFilePath:  "repo/file.txt",
 				ProjectNumber: "123",
@@ -89,6 +104,149 @@ func TestSettings_IsValid(t *testing.T) {
 			wantMissingArgs: []string{FlagNameRepoFolderPathEscaped},
 			wantErrors:      []string{"You can't use both outPath and outFolder"},
 		},
+		{
+			name: "Client certificate without key",
+			settings: Settings{
+				PrivateToken:   "token",
+				OutFile:        "output.txt",
+				Ref:            "main",
+				ApiUrl:         "https://api.example.com",
+				RepoFilePath:   "repo/file.txt",
+				ClientCertFile: "client.pem",
+			},
+			wantValid:       false,
+			wantMissingArgs: []string{FlagNameClientKeyFile},
+			wantErrors:      nil,
+		},
+		{
+			name: "Unknown TLS version",
+			settings: Settings{
+				PrivateToken:  "token",
+				OutFile:       "output.txt",
+				Ref:           "main",
+				ApiUrl:        "https://api.example.com",
+				RepoFilePath:  "repo/file.txt",
+				TLSMinVersion: "2.0",
+			},
+			wantValid:       false,
+			wantMissingArgs: nil,
+			wantErrors:      []string{"Unknown tlsMinVersion 2.0, use 1.0, 1.1, 1.2 or 1.3"},
+		},
+		{
+			name: "Deploy token without username",
+			settings: Settings{
+				PrivateToken: "token",
+				AuthType:     AuthDeployToken,
+				OutFile:      "output.txt",
+				Ref:          "main",
+				ApiUrl:       "https://api.example.com",
+				RepoFilePath: "repo/file.txt",
+			},
+			wantValid:       false,
+			wantMissingArgs: []string{FlagNameUsername},
+			wantErrors:      nil,
+		},
+		{
+			name: "Unknown auth type",
+			settings: Settings{
+				PrivateToken: "token",
+				AuthType:     "basic",
+				OutFile:      "output.txt",
+				Ref:          "main",
+				ApiUrl:       "https://api.example.com",
+				RepoFilePath: "repo/file.txt",
+			},
+			wantValid:       false,
+			wantMissingArgs: nil,
+			wantErrors:      []string{"Unknown authType basic, use private, job, deploy or bearer"},
+		},
+		{
+			name: "Unknown plan format",
+			settings: Settings{
+				PrivateToken: "token",
+				OutFile:      "output.txt",
+				Ref:          "main",
+				ApiUrl:       "https://api.example.com",
+				RepoFilePath: "repo/file.txt",
+				DryRun:       true,
+				PlanFormat:   "yaml",
+			},
+			wantValid:       false,
+			wantMissingArgs: nil,
+			wantErrors:      []string{"Unknown planFormat yaml, use text or json"},
+		},
+		{
+			name: "GitHub",
+			settings: Settings{
+				Provider:      ProviderGitHub,
+				PrivateToken:  "token",
+				OutFile:       "output.txt",
+				Ref:           "main",
+				ApiUrl:        "https://api.github.com/",
+				ProjectNumber: "haevg-rz/git-file-downloader",
+				RepoFilePath:  "repo/file.txt",
+			},
+			wantValid:       true,
+			wantMissingArgs: nil,
+			wantErrors:      nil,
+		},
+		{
+			name: "GitHub with project ID and job token",
+			settings: Settings{
+				Provider:      ProviderGitHub,
+				PrivateToken:  "token",
+				AuthType:      AuthJobToken,
+				OutFile:       "output.txt",
+				Ref:           "main",
+				ApiUrl:        "https://api.github.com/",
+				ProjectNumber: "123",
+				RepoFilePath:  "repo/file.txt",
+			},
+			wantValid:       false,
+			wantMissingArgs: nil,
+			wantErrors:      []string{"authType job is only supported by gitlab, use bearer or deploy", "Invalid project 123, use owner/repo for github"},
+		},
+		{
+			name: "Git repository without token",
+			settings: Settings{
+				Provider:     ProviderGit,
+				OutFile:      "output.txt",
+				Ref:          "main",
+				ApiUrl:       "file:///srv/git/config.git",
+				RepoFilePath: "repo/file.txt",
+			},
+			wantValid:       true,
+			wantMissingArgs: nil,
+			wantErrors:      nil,
+		},
+		{
+			name: "Git repository with submodules",
+			settings: Settings{
+				Provider:       ProviderGit,
+				OutFolder:      "out",
+				Ref:            "main",
+				ApiUrl:         "file:///srv/git/config.git",
+				RepoFolderPath: "conf",
+				Submodules:     SubmodulesRecurse,
+			},
+			wantValid:       false,
+			wantMissingArgs: nil,
+			wantErrors:      []string{"submodules recurse is not supported by git"},
+		},
+		{
+			name: "Unknown provider",
+			settings: Settings{
+				Provider:     "svn",
+				PrivateToken: "token",
+				OutFile:      "output.txt",
+				Ref:          "main",
+				ApiUrl:       "https://api.example.com",
+				RepoFilePath: "repo/file.txt",
+			},
+			wantValid:       false,
+			wantMissingArgs: nil,
+			wantErrors:      []string{"Unknown provider svn, use gitlab, github, gitea, bitbucket, azure or git"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -106,3 +264,32 @@ func TestSettings_IsValid(t *testing.T) {
 		})
 	}
 }
+
+func TestSettings_FilePerm(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		want     os.FileMode
+		wantErr  bool
+	}{
+		{name: "Default", settings: Settings{}, want: 0644},
+		{name: "Regular file", settings: Settings{RepoFileMode: "100644"}, want: 0644},
+		{name: "Executable", settings: Settings{RepoFileMode: GitModeExecutable}, want: 0755},
+		{name: "Override", settings: Settings{FileMode: "0640"}, want: 0640},
+		{name: "Override executable", settings: Settings{FileMode: "0640", RepoFileMode: GitModeExecutable}, want: 0750},
+		{name: "Invalid", settings: Settings{FileMode: "0999"}, wantErr: true},
+		{name: "Too large", settings: Settings{FileMode: "7777"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.settings.FilePerm()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Settings.FilePerm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Settings.FilePerm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Environment variables for the token, if -token isn't set. GDOWN_TOKEN is preferred, the others are
+// only used for their provider.
+const (
+	EnvToken          = "GDOWN_TOKEN"
+	EnvGitLabToken    = "GITLAB_TOKEN"
+	EnvGitHubToken    = "GITHUB_TOKEN"
+	EnvGiteaToken     = "GITEA_TOKEN"
+	EnvBitbucketToken = "BITBUCKET_TOKEN"
+	// EnvAzureToken is the personal access token variable of the Azure DevOps CLI
+	EnvAzureToken = "AZURE_DEVOPS_EXT_PAT"
+)
+
+// gitCommand is the git binary used for the credential helper
+var gitCommand = "git"
+
+// TokenFromEnv returns the token of the first set environment variable for provider
+func TokenFromEnv(provider string) string {
+	for _, name := range tokenEnvNames(provider) {
+		if token := os.Getenv(name); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// tokenEnvNames returns the environment variables TokenFromEnv reads for provider, in this order
+func tokenEnvNames(provider string) []string {
+	providerEnv := EnvGitLabToken
+	switch provider {
+	case ProviderGitHub:
+		providerEnv = EnvGitHubToken
+	case ProviderGitea:
+		providerEnv = EnvGiteaToken
+	case ProviderBitbucket:
+		providerEnv = EnvBitbucketToken
+	case ProviderAzure:
+		providerEnv = EnvAzureToken
+	case ProviderGit:
+		// The host of a git remote can be anything, so there's no variable of a provider
+		return []string{EnvToken}
+	}
+	return []string{EnvToken, providerEnv}
+}
+
+// ResolveToken returns PrivateToken, the content of TokenFile or the password of the git credential
+// helper for ApiUrl, the first source which is set is used
+func (s Settings) ResolveToken(ctx context.Context) (string, error) {
+	if s.PrivateToken != "" {
+		return s.PrivateToken, nil
+	}
+	if s.TokenFile != "" {
+		return readTokenFile(s.TokenFile)
+	}
+	if s.CredentialHelper {
+		return credentialFill(ctx, s.ApiUrl)
+	}
+	if s.Provider == ProviderGit {
+		// A local repository or a public remote
+		return "", nil
+	}
+	return "", fmt.Errorf("no token, use %v, %v, %v or %v", FlagNameToken, strings.Join(tokenEnvNames(s.Provider), ", "), FlagNameTokenFile, FlagNameCredentialHelper)
+}
+
+// readTokenFile reads the token from path. Like ssh does for keys, the file must not be accessible by
+// group or others.
+func readTokenFile(path string) (string, error) {
+	if err := checkPrivateFile(FlagNameTokenFile, path); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%v %v is empty", FlagNameTokenFile, path)
+	}
+	return token, nil
+}
+
+// checkPrivateFile returns an error if the file of the flag name at path, which contains a token, is
+// accessible by group or others
+func checkPrivateFile(name, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%v %v is accessible by group or others (%v), use chmod 600", name, path, info.Mode().Perm())
+	}
+	return nil
+}
+
+// credentialFill asks the configured git credential helpers for the password of apiUrl, like git does
+// before a clone. git never prompts, a missing credential is an error.
+func credentialFill(ctx context.Context, apiUrl string) (string, error) {
+	u, err := url.Parse(apiUrl)
+	if err != nil {
+		return "", err
+	}
+
+	input := fmt.Sprintf("protocol=%v\nhost=%v\n\n", u.Scheme, u.Host)
+	cmd := exec.CommandContext(ctx, gitCommand, "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git credential fill for %v: %v %v", u.Host, err, strings.TrimSpace(stderr.String()))
+	}
+
+	password := parseCredential(output)["password"]
+	if password == "" {
+		return "", fmt.Errorf("git credential fill for %v: no password", u.Host)
+	}
+	return password, nil
+}
+
+// parseCredential parses the key=value lines of the git credential protocol
+func parseCredential(output []byte) map[string]string {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found {
+			values[key] = value
+		}
+	}
+	return values
+}
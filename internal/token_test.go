@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestTokenFromEnv(t *testing.T) {
+	t.Setenv(EnvToken, "")
+	t.Setenv(EnvGitLabToken, "gitlab")
+	t.Setenv(EnvGitHubToken, "github")
+	if got := TokenFromEnv(ProviderGitLab); got != "gitlab" {
+		t.Errorf("TokenFromEnv() = %v, want %v", got, "gitlab")
+	}
+	if got := TokenFromEnv(ProviderGitHub); got != "github" {
+		t.Errorf("TokenFromEnv() = %v, want %v", got, "github")
+	}
+
+	t.Setenv(EnvToken, "gdown")
+	if got := TokenFromEnv(ProviderGitHub); got != "gdown" {
+		t.Errorf("TokenFromEnv() = %v, want %v", got, "gdown")
+	}
+}
+
+func TestSettings_ResolveToken(t *testing.T) {
+	folder := t.TempDir()
+	tokenFile := filepath.Join(folder, "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	openTokenFile := filepath.Join(folder, "open-token")
+	if err := os.WriteFile(openTokenFile, []byte("file-token\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyTokenFile := filepath.Join(folder, "empty-token")
+	if err := os.WriteFile(emptyTokenFile, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings Settings
+		want     string
+		wantErr  bool
+		unixOnly bool
+	}{
+		{name: "Token", settings: Settings{PrivateToken: "token", TokenFile: tokenFile}, want: "token"},
+		{name: "Token file", settings: Settings{TokenFile: tokenFile}, want: "file-token"},
+		{name: "Token file accessible by others", settings: Settings{TokenFile: openTokenFile}, wantErr: true, unixOnly: true},
+		{name: "Empty token file", settings: Settings{TokenFile: emptyTokenFile}, wantErr: true},
+		{name: "Missing token file", settings: Settings{TokenFile: filepath.Join(folder, "missing")}, wantErr: true},
+		{name: "No token", settings: Settings{}, wantErr: true},
+		{name: "No token for a git repository", settings: Settings{Provider: ProviderGit}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.unixOnly && runtime.GOOS == "windows" {
+				t.Skip("no unix permissions")
+			}
+			got, err := tt.settings.ResolveToken(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Settings.ResolveToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Settings.ResolveToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettings_ResolveToken_NoToken(t *testing.T) {
+	tests := []struct {
+		provider string
+		want     string
+	}{
+		{provider: "", want: "no token, use token, GDOWN_TOKEN, GITLAB_TOKEN, tokenFile or credentialHelper"},
+		{provider: ProviderGitHub, want: "no token, use token, GDOWN_TOKEN, GITHUB_TOKEN, tokenFile or credentialHelper"},
+		{provider: ProviderAzure, want: "no token, use token, GDOWN_TOKEN, AZURE_DEVOPS_EXT_PAT, tokenFile or credentialHelper"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			_, err := (Settings{Provider: tt.provider}).ResolveToken(context.Background())
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Settings.ResolveToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettings_ResolveToken_CredentialHelper(t *testing.T) {
+	if _, err := exec.LookPath(gitCommand); err != nil {
+		t.Skip("git not found")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("shell helper")
+	}
+
+	config := filepath.Join(t.TempDir(), "gitconfig")
+	helper := `[credential "https://gitlab.example.com"]
+	helper = "!f() { test \"$1\" = get && echo username=gdown && echo password=helper-token; }; f"
+`
+	if err := os.WriteFile(config, []byte(helper), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", config)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	settings := Settings{ApiUrl: "https://gitlab.example.com/api/v4/", CredentialHelper: true}
+	got, err := settings.ResolveToken(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "helper-token" {
+		t.Errorf("Settings.ResolveToken() = %v, want %v", got, "helper-token")
+	}
+
+	// No helper for the host, git must fail instead of prompting
+	settings.ApiUrl = "https://other.example.com/api/v4/"
+	if _, err := settings.ResolveToken(context.Background()); err == nil {
+		t.Error("Settings.ResolveToken() without credential, want error")
+	}
+}
+
+func Test_parseCredential(t *testing.T) {
+	got := parseCredential([]byte("protocol=https\nhost=gitlab.example.com\nusername=gdown\npassword=a=b\n"))
+	if got["password"] != "a=b" || got["username"] != "gdown" {
+		t.Errorf("parseCredential() = %v", got)
+	}
+}